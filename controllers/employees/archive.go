@@ -0,0 +1,274 @@
+package employees
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"awesomeProject/domains"
+	"awesomeProject/utils/xlsx"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ratioCheckThreshold is the expanded size below which the compression ratio of an archive is not
+// checked, as small files of repetitive CSV can legitimately compress very well.
+const ratioCheckThreshold = 1 << 20
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func isGzip(header []byte) bool {
+	return bytes.HasPrefix(header, gzipMagic)
+}
+
+// isTar checks for the ustar magic of a tar header, which follows the first 257 bytes.
+func isTar(header []byte) bool {
+	return len(header) >= 262 && string(header[257:262]) == "ustar"
+}
+
+// archiveEntry is a file expanded from an archive, spooled under a temporary name until the
+// entries have been sorted.
+type archiveEntry struct {
+	name        string
+	path        string
+	contentHash string
+}
+
+// expandArchive replaces a spooled zip, gzip or tar.gz archive by the CSV files it contains,
+// which are added to the job in order of their names so the same archive is always processed the
+// same way. It reports false, leaving the file as is, if it is not an archive. Archives within
+// archives are not expanded.
+func (h *employeeHandler) expandArchive(job *domains.UploadJob, spoolPath string, filename string) (bool, error) {
+	archive, err := os.Open(spoolPath)
+	if err != nil {
+		return false, err
+	}
+	info, err := archive.Stat()
+	if err != nil {
+		archive.Close()
+		return false, err
+	}
+	header := make([]byte, 4)
+	n, _ := archive.ReadAt(header, 0)
+
+	var entries []archiveEntry
+	defer func() {
+		// entries that were not moved into the job
+		for _, entry := range entries {
+			os.Remove(entry.path)
+		}
+	}()
+	switch {
+	case xlsx.IsZip(header[:n]) && !xlsx.IsWorkbook(archive, info.Size()):
+		entries, err = h.expandZip(archive, info.Size(), job)
+	case isGzip(header[:n]):
+		entries, err = h.expandGzip(archive, filename, job)
+	default:
+		archive.Close()
+		return false, nil
+	}
+	archive.Close()
+	if err != nil {
+		return true, err
+	}
+	if err := os.Remove(spoolPath); err != nil {
+		return true, err
+	}
+	if len(entries) == 0 {
+		return true, errors.New(fmt.Sprintf("Invalid archive: %v contains no CSV files", filename))
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	for _, entry := range entries {
+		if err := os.Rename(entry.path, h.spoolPath(job.ID, len(job.Files))); err != nil {
+			return true, err
+		}
+		job.Files = append(job.Files, domains.UploadFile{
+			Filename:    path.Join(filename, entry.name),
+			Archive:     filename,
+			ContentHash: entry.contentHash,
+		})
+	}
+	return true, nil
+}
+
+func (h *employeeHandler) expandZip(r io.ReaderAt, size int64, job *domains.UploadJob) ([]archiveEntry, error) {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid archive: %v", err))
+	}
+
+	var compressed int64
+	guard := h.newArchiveGuard(func() int64 { return compressed })
+	var entries []archiveEntry
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || !isCSVEntry(file.Name) {
+			continue
+		}
+		if err := guard.addEntry(); err != nil {
+			return entries, err
+		}
+		compressed += int64(file.CompressedSize64)
+
+		src, err := file.Open()
+		if err != nil {
+			return entries, errors.New(fmt.Sprintf("Invalid archive: %v: %v", file.Name, err))
+		}
+		entry, err := h.spoolEntry(guard.reader(src), file.Name, job, len(entries))
+		src.Close()
+		entries = append(entries, entry)
+		if err != nil {
+			return entries, err
+		}
+	}
+	return entries, nil
+}
+
+// expandGzip expands a tar.gz archive, or a single gzip compressed file.
+func (h *employeeHandler) expandGzip(r io.Reader, filename string, job *domains.UploadJob) ([]archiveEntry, error) {
+	counter := &countingReader{r: bufio.NewReader(r)}
+	gz, err := gzip.NewReader(counter)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid archive: %v", err))
+	}
+	defer gz.Close()
+	guard := h.newArchiveGuard(func() int64 { return counter.n })
+	expanded := bufio.NewReader(guard.reader(gz))
+
+	header, _ := expanded.Peek(262)
+	if !isTar(header) {
+		name := gz.Name
+		if name == "" {
+			name = strings.TrimSuffix(path.Base(filename), ".gz")
+		}
+		if err := guard.addEntry(); err != nil {
+			return nil, err
+		}
+		entry, err := h.spoolEntry(expanded, name, job, 0)
+		return []archiveEntry{entry}, err
+	}
+
+	reader := tar.NewReader(expanded)
+	var entries []archiveEntry
+	for {
+		file, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, errors.New(fmt.Sprintf("Invalid archive: %v", err))
+		}
+		if file.Typeflag != tar.TypeReg || !isCSVEntry(file.Name) {
+			continue
+		}
+		if err := guard.addEntry(); err != nil {
+			return entries, err
+		}
+		entry, err := h.spoolEntry(reader, file.Name, job, len(entries))
+		entries = append(entries, entry)
+		if err != nil {
+			return entries, err
+		}
+	}
+}
+
+// spoolEntry spools an expanded file under a temporary name, enforcing the same limits as for an
+// uploaded file. The entry is returned even on error so it can be removed. Its name is made
+// relative to the archive, so that e.g. ../employees.csv names a file within it.
+func (h *employeeHandler) spoolEntry(src io.Reader, name string, job *domains.UploadJob, i int) (archiveEntry, error) {
+	entry := archiveEntry{
+		name: strings.TrimPrefix(path.Clean("/"+name), "/"),
+		path: filepath.Join(h.uploadConfig.SpoolDir, fmt.Sprintf("%v-entry-%v", job.ID, i)),
+	}
+	var err error
+	entry.contentHash, err = spool(&limitedReader{r: src, limit: h.uploadConfig.MaxFileSize}, entry.path, func(r io.Reader) error {
+		return countRows(r, job.Options.Charset, h.uploadConfig.ColumnAliases, h.uploadConfig.MaxRows)
+	})
+	return entry, err
+}
+
+// isCSVEntry reports whether an archive entry is a CSV file, skipping the metadata some archivers
+// add, e.g. __MACOSX/._employees.csv.
+func isCSVEntry(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".csv") &&
+		!strings.HasPrefix(path.Base(name), ".") &&
+		!strings.HasPrefix(name, "__MACOSX/")
+}
+
+// archiveGuard protects against archives that expand to far more data than was uploaded.
+type archiveGuard struct {
+	maxEntries      int
+	maxExpandedSize int64
+	maxRatio        int64
+	entries         int
+	expanded        int64
+	compressed      func() int64 // compressed bytes read so far
+}
+
+func (h *employeeHandler) newArchiveGuard(compressed func() int64) *archiveGuard {
+	return &archiveGuard{
+		maxEntries:      h.uploadConfig.MaxArchiveEntries,
+		maxExpandedSize: h.uploadConfig.MaxExpandedSize,
+		maxRatio:        int64(h.uploadConfig.MaxCompressionRatio),
+		compressed:      compressed,
+	}
+}
+
+// workbookGuard guards the parts of an xlsx workbook, which is a zip archive too, as they are
+// decoded. The parts of a workbook are not counted as entries.
+func (h *employeeHandler) workbookGuard() xlsx.Guard {
+	var compressed int64
+	guard := h.newArchiveGuard(func() int64 { return compressed })
+	return func(part io.Reader, size int64) io.Reader {
+		compressed += size
+		return guard.reader(part)
+	}
+}
+
+func (g *archiveGuard) addEntry() error {
+	g.entries++
+	if g.entries > g.maxEntries {
+		return &limitError{fmt.Sprintf("Too many files in archive: archives may contain at most %v CSV files", g.maxEntries)}
+	}
+	return nil
+}
+
+func (g *archiveGuard) reader(r io.Reader) io.Reader {
+	return &guardedReader{r: r, guard: g}
+}
+
+type guardedReader struct {
+	r     io.Reader
+	guard *archiveGuard
+}
+
+func (r *guardedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	g := r.guard
+	g.expanded += int64(n)
+	if g.expanded > g.maxExpandedSize {
+		return n, &limitError{fmt.Sprintf("Archive too large: archives may expand to at most %v bytes", g.maxExpandedSize)}
+	}
+	if g.expanded > ratioCheckThreshold && g.expanded > g.maxRatio*g.compressed() {
+		return n, &limitError{fmt.Sprintf("Archive too large: archives may be compressed at most %v:1", g.maxRatio)}
+	}
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
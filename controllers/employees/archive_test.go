@@ -0,0 +1,326 @@
+package employees
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"awesomeProject/domains"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// archiveFile is an entry of a test archive.
+type archiveFile struct {
+	name    string
+	content string
+}
+
+func zipArchive(t *testing.T, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := writer.Create(file.name)
+		if err != nil {
+			t.Fatalf("zip.Create() returned error %v", err)
+		}
+		w.Write([]byte(file.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("zip.Close() returned error %v", err)
+	}
+	return buf.Bytes()
+}
+
+func gzipFile(t *testing.T, name string, content []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Name = name
+	writer.Write(content)
+	if err := writer.Close(); err != nil {
+		t.Fatalf("gzip.Close() returned error %v", err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzArchive(t *testing.T, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0600, Size: int64(len(file.content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(file.name, "/") {
+			header.Typeflag, header.Size = tar.TypeDir, 0
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatalf("tar.WriteHeader() returned error %v", err)
+		}
+		writer.Write([]byte(file.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("tar.Close() returned error %v", err)
+	}
+	return gzipFile(t, "", buf.Bytes())
+}
+
+const archiveCSV = "id,login,name,salary\ne0001,hpotter,Harry Potter,1234.00\n"
+
+func TestExpandArchive(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  func(t *testing.T) []byte
+		want     []string // filenames of the files of the job
+	}{
+		{
+			name:     "zip in order of names",
+			filename: "offices.zip",
+			content: func(t *testing.T) []byte {
+				return zipArchive(t, archiveFile{"sales.csv", archiveCSV}, archiveFile{"finance/", ""},
+					archiveFile{"finance/Payroll.CSV", archiveCSV}, archiveFile{"engineering.csv", archiveCSV})
+			},
+			want: []string{"offices.zip/engineering.csv", "offices.zip/finance/Payroll.CSV", "offices.zip/sales.csv"},
+		},
+		{
+			name:     "zip metadata and other files are ignored",
+			filename: "offices.zip",
+			content: func(t *testing.T) []byte {
+				return zipArchive(t, archiveFile{"sales.csv", archiveCSV}, archiveFile{"__MACOSX/._sales.csv", "\x00\x05"},
+					archiveFile{".hidden.csv", archiveCSV}, archiveFile{"notes.txt", "notes"})
+			},
+			want: []string{"offices.zip/sales.csv"},
+		},
+		{
+			name:     "archives in archives are not expanded",
+			filename: "offices.zip",
+			content: func(t *testing.T) []byte {
+				nested := zipArchive(t, archiveFile{"nested.csv", archiveCSV})
+				return zipArchive(t, archiveFile{"sales.csv", archiveCSV}, archiveFile{"nested.zip", string(nested)},
+					archiveFile{"nested.csv.gz", string(gzipFile(t, "nested.csv", []byte(archiveCSV)))})
+			},
+			want: []string{"offices.zip/sales.csv"},
+		},
+		{
+			name:     "entries are named within the archive",
+			filename: "offices.zip",
+			content: func(t *testing.T) []byte {
+				return zipArchive(t, archiveFile{"../../etc/passwd.csv", archiveCSV}, archiveFile{"/abs/sales.csv", archiveCSV},
+					archiveFile{"a/./b/../c.csv", archiveCSV})
+			},
+			want: []string{"offices.zip/a/c.csv", "offices.zip/abs/sales.csv", "offices.zip/etc/passwd.csv"},
+		},
+		{
+			name:     "tar.gz",
+			filename: "offices.tar.gz",
+			content: func(t *testing.T) []byte {
+				return tarGzArchive(t, archiveFile{"offices/", ""}, archiveFile{"offices/sales.csv", archiveCSV},
+					archiveFile{"../finance.csv", archiveCSV}, archiveFile{"offices/readme.md", "readme"})
+			},
+			want: []string{"offices.tar.gz/finance.csv", "offices.tar.gz/offices/sales.csv"},
+		},
+		{
+			name:     "gzip named by its header",
+			filename: "upload.gz",
+			content: func(t *testing.T) []byte {
+				return gzipFile(t, "employees.csv", []byte(archiveCSV))
+			},
+			want: []string{"upload.gz/employees.csv"},
+		},
+		{
+			name:     "gzip named after the upload",
+			filename: "employees.csv.gz",
+			content: func(t *testing.T) []byte {
+				return gzipFile(t, "", []byte(archiveCSV))
+			},
+			want: []string{"employees.csv.gz/employees.csv"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, job, spoolPath := spoolArchive(t, DefaultUploadConfig(), test.content(t))
+			archive, err := h.expandArchive(job, spoolPath, test.filename)
+			if !archive || err != nil {
+				t.Fatalf("expandArchive() = %v, %v, want an archive", archive, err)
+			}
+			var filenames []string
+			for i, file := range job.Files {
+				filenames = append(filenames, file.Filename)
+				if file.Archive != test.filename {
+					t.Errorf("file %v is from archive %q, want %q", file.Filename, file.Archive, test.filename)
+				}
+				content, err := os.ReadFile(h.spoolPath(job.ID, i))
+				if err != nil || string(content) != archiveCSV {
+					t.Errorf("file %v was spooled as %q, %v, want %q", file.Filename, content, err, archiveCSV)
+				}
+			}
+			if !reflect.DeepEqual(filenames, test.want) {
+				t.Errorf("expandArchive() added files %q, want %q", filenames, test.want)
+			}
+			if entries, _ := os.ReadDir(h.uploadConfig.SpoolDir); len(entries) != len(job.Files) {
+				t.Errorf("the spool directory holds %v files, want only the %v files of the job", len(entries), len(job.Files))
+			}
+		})
+	}
+}
+
+func TestExpandArchiveNotArchive(t *testing.T) {
+	var workbook bytes.Buffer
+	writer, err := newEmployeeWriter(&workbook, formatXLSX)
+	if err != nil {
+		t.Fatalf("newEmployeeWriter() returned error %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() returned error %v", err)
+	}
+	for _, content := range [][]byte{[]byte(archiveCSV), workbook.Bytes()} {
+		h, job, spoolPath := spoolArchive(t, DefaultUploadConfig(), content)
+		archive, err := h.expandArchive(job, spoolPath, "employees")
+		if archive || err != nil || len(job.Files) != 0 {
+			t.Errorf("expandArchive() = %v, %v with files %v, want no archive", archive, err, job.Files)
+		}
+	}
+}
+
+func TestExpandArchiveLimits(t *testing.T) {
+	bomb := strings.Repeat("e0001,hpotter,Harry Potter,1234.00\n", 4<<20/35)
+	tests := []struct {
+		name    string
+		config  func(config *UploadConfig)
+		content func(t *testing.T) []byte
+		want    string // start of the error
+	}{
+		{
+			name:   "too many entries",
+			config: func(config *UploadConfig) { config.MaxArchiveEntries = 2 },
+			content: func(t *testing.T) []byte {
+				return zipArchive(t, archiveFile{"a.csv", archiveCSV}, archiveFile{"b.csv", archiveCSV}, archiveFile{"c.csv", archiveCSV})
+			},
+			want: "Too many files in archive: archives may contain at most 2 CSV files",
+		},
+		{
+			name:   "too many tar entries",
+			config: func(config *UploadConfig) { config.MaxArchiveEntries = 1 },
+			content: func(t *testing.T) []byte {
+				return tarGzArchive(t, archiveFile{"a.csv", archiveCSV}, archiveFile{"b.csv", archiveCSV})
+			},
+			want: "Too many files in archive: archives may contain at most 1 CSV files",
+		},
+		{
+			name:   "entry too large",
+			config: func(config *UploadConfig) { config.MaxFileSize = int64(len(archiveCSV)) - 1 },
+			content: func(t *testing.T) []byte {
+				return zipArchive(t, archiveFile{"a.csv", archiveCSV})
+			},
+			want: "File too large",
+		},
+		{
+			name:   "entry with too many rows",
+			config: func(config *UploadConfig) { config.MaxRows = 1 },
+			content: func(t *testing.T) []byte {
+				return zipArchive(t, archiveFile{"a.csv", archiveCSV + "e0002,rwesley,Ron Weasley,19234.50\n"})
+			},
+			want: "Too many rows",
+		},
+		{
+			name:   "entries expand too much together",
+			config: func(config *UploadConfig) { config.MaxExpandedSize = int64(2*len(archiveCSV)) - 1 },
+			content: func(t *testing.T) []byte {
+				return zipArchive(t, archiveFile{"a.csv", archiveCSV}, archiveFile{"b.csv", archiveCSV})
+			},
+			want: "Archive too large: archives may expand to at most",
+		},
+		{
+			name:   "zip bomb",
+			config: func(config *UploadConfig) { config.MaxRows = 1 << 20 },
+			content: func(t *testing.T) []byte {
+				return zipArchive(t, archiveFile{"bomb.csv", bomb})
+			},
+			want: "Archive too large: archives may be compressed at most 100:1",
+		},
+		{
+			name:   "gzip bomb",
+			config: func(config *UploadConfig) { config.MaxRows = 1 << 20 },
+			content: func(t *testing.T) []byte {
+				return gzipFile(t, "bomb.csv", []byte(bomb))
+			},
+			want: "Archive too large: archives may be compressed at most 100:1",
+		},
+		{
+			name:   "tar.gz bomb",
+			config: func(config *UploadConfig) { config.MaxRows = 1 << 20 },
+			content: func(t *testing.T) []byte {
+				return tarGzArchive(t, archiveFile{"bomb.csv", bomb})
+			},
+			want: "Archive too large: archives may be compressed at most 100:1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultUploadConfig()
+			test.config(&config)
+			h, job, spoolPath := spoolArchive(t, config, test.content(t))
+			archive, err := h.expandArchive(job, spoolPath, "upload")
+			var limitErr *limitError
+			if !archive || !errors.As(err, &limitErr) || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("expandArchive() = %v, %v, want an archive failing with %q", archive, err, test.want)
+			}
+			if status := uploadErrorStatus(err); status != 413 {
+				t.Errorf("expandArchive() failed with status %v, want 413", status)
+			}
+			assertOnlySpooled(t, h, spoolPath)
+		})
+	}
+}
+
+func TestExpandArchiveInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content func(t *testing.T) []byte
+		want    string
+	}{
+		{"no CSV files", func(t *testing.T) []byte { return zipArchive(t, archiveFile{"notes.txt", "notes"}) }, "Invalid archive: upload contains no CSV files"},
+		{"truncated zip", func(t *testing.T) []byte { return zipArchive(t, archiveFile{"a.csv", archiveCSV})[:40] }, "Invalid archive"},
+		{"truncated gzip", func(t *testing.T) []byte { return []byte{0x1f, 0x8b, 0x08} }, "Invalid archive"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, job, spoolPath := spoolArchive(t, DefaultUploadConfig(), test.content(t))
+			archive, err := h.expandArchive(job, spoolPath, "upload")
+			if !archive || err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("expandArchive() = %v, %v, want an archive failing with %q", archive, err, test.want)
+			}
+			if len(job.Files) != 0 {
+				t.Errorf("expandArchive() added files %v", job.Files)
+			}
+		})
+	}
+}
+
+// spoolArchive spools an uploaded archive for a new job, as the first file of the job.
+func spoolArchive(t *testing.T, config UploadConfig, content []byte) (*employeeHandler, *domains.UploadJob, string) {
+	config.SpoolDir = t.TempDir()
+	h := &employeeHandler{uploadConfig: config}
+	job := &domains.UploadJob{ID: "job"}
+	spoolPath := h.spoolPath(job.ID, 0)
+	if err := os.WriteFile(spoolPath, content, 0600); err != nil {
+		t.Fatalf("os.WriteFile() returned error %v", err)
+	}
+	return h, job, spoolPath
+}
+
+// assertOnlySpooled checks that the entries expanded from a rejected archive were removed,
+// leaving only the archive itself to be removed with the upload.
+func assertOnlySpooled(t *testing.T, h *employeeHandler, spoolPath string) {
+	files, err := os.ReadDir(h.uploadConfig.SpoolDir)
+	if err != nil {
+		t.Fatalf("os.ReadDir() returned error %v", err)
+	}
+	for _, file := range files {
+		if filepath.Join(h.uploadConfig.SpoolDir, file.Name()) != spoolPath {
+			t.Errorf("%v was left in the spool directory", file.Name())
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package employees
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// employeeColumns are the columns of an employee file, in the order expected when the file has
+// no header row.
+var employeeColumns = []string{"id", "login", "name", "salary"}
+
+// DefaultColumnAliases maps alternative header names to the employee column they refer to. Words
+// that could as well be a login or name, such as "user", are left out, as a data row holding them
+// must not be mistaken for a header.
+var DefaultColumnAliases = map[string]string{
+	"employee_id":   "id",
+	"emp_id":        "id",
+	"employeeid":    "id",
+	"username":      "login",
+	"full_name":     "name",
+	"employee_name": "name",
+}
+
+// columnMapping is the position of every employee column within a record.
+type columnMapping struct {
+	indexes map[string]int
+	header  bool // whether the mapping came from a header row, in which case extra columns are ignored
+}
+
+func (m columnMapping) width() int {
+	width := 0
+	for _, i := range m.indexes {
+		if i+1 > width {
+			width = i + 1
+		}
+	}
+	return width
+}
+
+func defaultColumnMapping() columnMapping {
+	indexes := make(map[string]int, len(employeeColumns))
+	for i, col := range employeeColumns {
+		indexes[col] = i
+	}
+	return columnMapping{indexes: indexes}
+}
+
+// detectHeader reports whether fields is a header row, and if so maps the columns by name. Unknown
+// columns are ignored, but every employee column must be present exactly once. A row is a header
+// if every employee column is named by one of its fields or their aliases. A row that names only
+// some of them is taken for a header that misses the others if its salary field is not a number,
+// and otherwise for a data row that happens to hold a column name, e.g. an employee named "Name".
+func detectHeader(fields []string, aliases map[string]string) (columnMapping, bool, error) {
+	indexes := make(map[string]int, len(employeeColumns))
+	var duplicate string
+	for i, field := range fields {
+		col, ok := columnName(field, aliases)
+		if !ok {
+			continue
+		}
+		if _, seen := indexes[col]; seen && duplicate == "" {
+			duplicate = col
+		}
+		indexes[col] = i
+	}
+	if len(indexes) == 0 {
+		return columnMapping{}, false, nil
+	}
+
+	var missing []string
+	for _, col := range employeeColumns {
+		if _, ok := indexes[col]; !ok {
+			missing = append(missing, col)
+		}
+	}
+	if len(missing) > 0 && isNumericSalary(fields) {
+		return columnMapping{}, false, nil
+	}
+	if duplicate != "" {
+		return columnMapping{}, true, errors.New(fmt.Sprintf("Invalid header: column %v appears more than once", duplicate))
+	}
+	if len(missing) > 0 {
+		return columnMapping{}, true, errors.New(fmt.Sprintf("Invalid header: required column(s) missing: %v", strings.Join(missing, ", ")))
+	}
+	return columnMapping{indexes: indexes, header: true}, true, nil
+}
+
+// isNumericSalary reports whether the salary field of a row without a header, i.e. the last of
+// the employee columns, is a number.
+func isNumericSalary(fields []string) bool {
+	i := len(employeeColumns) - 1
+	if i >= len(fields) {
+		return false
+	}
+	_, err := strconv.ParseFloat(strings.TrimSpace(fields[i]), 64)
+	return err == nil
+}
+
+func columnName(field string, aliases map[string]string) (string, bool) {
+	name := normalizeColumnName(field)
+	for _, col := range employeeColumns {
+		if name == col {
+			return col, true
+		}
+	}
+	col, ok := aliases[name]
+	return col, ok
+}
+
+// ParseColumnAliases parses a comma separated list of alias=column pairs, e.g.
+// "staff_no=id,wage=salary".
+func ParseColumnAliases(s string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		alias, col, ok := strings.Cut(pair, "=")
+		col, known := columnName(col, nil)
+		if !ok || !known || strings.TrimSpace(alias) == "" {
+			return nil, errors.New(fmt.Sprintf("Invalid column alias %q: expected alias=column where column is one of %v", pair, strings.Join(employeeColumns, ", ")))
+		}
+		aliases[normalizeColumnName(alias)] = col
+	}
+	return aliases, nil
+}
+
+func normalizeColumnName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+}
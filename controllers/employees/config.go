@@ -0,0 +1,208 @@
+package employees
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSpoolDir is relative to the working directory of the service, which unlike the OS temp
+// directory is kept across reboots.
+const defaultSpoolDir = "spool"
+
+type UploadConfig struct {
+	// SpoolDir holds uploaded files until their job has been processed, including across
+	// restarts, so it should not be cleared on reboot like a temp directory.
+	SpoolDir string
+	// ColumnAliases maps alternative header names to employee columns.
+	ColumnAliases map[string]string
+	// BatchSize is the number of rows written per multi-row statement.
+	BatchSize int
+	// MaxFileSize is the size in bytes of the largest file accepted.
+	MaxFileSize int64
+	// MaxRows is the most employee rows accepted per file.
+	MaxRows int
+	// MaxFiles is the most files accepted per upload, counting an archive as a single file.
+	MaxFiles int
+	// MaxArchiveEntries is the most CSV files accepted per zip or tar.gz archive.
+	MaxArchiveEntries int
+	// MaxExpandedSize is the most bytes an archive may expand to.
+	MaxExpandedSize int64
+	// MaxCompressionRatio is the highest ratio of expanded to compressed size accepted for an
+	// archive.
+	MaxCompressionRatio int
+	// MaxSyncDeletePercent is the largest share of the existing employees, in percent, that a
+	// sync upload may delete.
+	MaxSyncDeletePercent float64
+	// DropDir is watched for CSV files to process, if set.
+	DropDir string
+	// DropPollInterval is how often DropDir is checked for new files.
+	DropPollInterval time.Duration
+	// DropSettleTime is how long a file in DropDir must stay unchanged before it is processed.
+	DropSettleTime time.Duration
+	// TrustedProxies are the addresses or CIDR ranges of the proxies in front of the service,
+	// trusted to set the X-Forwarded-For and X-Uploader headers of the requests they forward. No
+	// proxy is trusted by default.
+	TrustedProxies []string
+}
+
+func DefaultUploadConfig() UploadConfig {
+	aliases := make(map[string]string, len(DefaultColumnAliases))
+	for alias, col := range DefaultColumnAliases {
+		aliases[alias] = col
+	}
+	return UploadConfig{
+		SpoolDir:      defaultSpoolDir,
+		ColumnAliases: aliases,
+		BatchSize:     500,
+		MaxFileSize:   64 << 20,
+		MaxRows:       100000,
+		MaxFiles:      10,
+
+		MaxArchiveEntries:   100,
+		MaxExpandedSize:     256 << 20,
+		MaxCompressionRatio: 100,
+
+		MaxSyncDeletePercent: 10,
+
+		DropPollInterval: 5 * time.Second,
+		DropSettleTime:   10 * time.Second,
+	}
+}
+
+// LoadUploadConfig returns the default UploadConfig, overridden by the UPLOAD_* environment
+// variables that are set.
+func LoadUploadConfig() (UploadConfig, error) {
+	config := DefaultUploadConfig()
+	if spoolDir := os.Getenv("UPLOAD_SPOOL_DIR"); spoolDir != "" {
+		config.SpoolDir = spoolDir
+	}
+	if aliases := os.Getenv("UPLOAD_COLUMN_ALIASES"); aliases != "" {
+		columnAliases, err := ParseColumnAliases(aliases)
+		if err != nil {
+			return config, errors.New(fmt.Sprintf("Invalid UPLOAD_COLUMN_ALIASES: %v", err))
+		}
+		for alias, col := range columnAliases {
+			config.ColumnAliases[alias] = col
+		}
+	}
+	config.DropDir = os.Getenv("UPLOAD_DROP_DIR")
+	if proxies := os.Getenv("UPLOAD_TRUSTED_PROXIES"); proxies != "" {
+		for _, proxy := range strings.Split(proxies, ",") {
+			config.TrustedProxies = append(config.TrustedProxies, strings.TrimSpace(proxy))
+		}
+		if _, err := parseProxies(config.TrustedProxies); err != nil {
+			return config, errors.New(fmt.Sprintf("Invalid UPLOAD_TRUSTED_PROXIES: %v", err))
+		}
+	}
+
+	for _, err := range []error{
+		envInt("UPLOAD_BATCH_SIZE", &config.BatchSize),
+		envSize("UPLOAD_MAX_FILE_SIZE", &config.MaxFileSize),
+		envInt("UPLOAD_MAX_ROWS", &config.MaxRows),
+		envInt("UPLOAD_MAX_FILES", &config.MaxFiles),
+		envInt("UPLOAD_MAX_ARCHIVE_ENTRIES", &config.MaxArchiveEntries),
+		envSize("UPLOAD_MAX_EXPANDED_SIZE", &config.MaxExpandedSize),
+		envInt("UPLOAD_MAX_COMPRESSION_RATIO", &config.MaxCompressionRatio),
+		envPercent("UPLOAD_MAX_SYNC_DELETE_PERCENT", &config.MaxSyncDeletePercent),
+		envDuration("UPLOAD_DROP_POLL_INTERVAL", &config.DropPollInterval, true),
+		envDuration("UPLOAD_DROP_SETTLE_TIME", &config.DropSettleTime, false),
+	} {
+		if err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// envInt sets value from the environment variable name if it is set, which must be a positive
+// integer.
+func envInt(name string, value *int) error {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return errors.New(fmt.Sprintf("%v should be a positive integer, got %q", name, s))
+	}
+	*value = n
+	return nil
+}
+
+// envSize sets value from the environment variable name if it is set, which must be a positive
+// number of bytes.
+func envSize(name string, value *int64) error {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return errors.New(fmt.Sprintf("%v should be a positive number of bytes, got %q", name, s))
+	}
+	*value = n
+	return nil
+}
+
+// envPercent sets value from the environment variable name if it is set, which must be a number
+// from 0 to 100.
+func envPercent(name string, value *float64) error {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil
+	}
+	percent, err := strconv.ParseFloat(s, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return errors.New(fmt.Sprintf("%v should be a number from 0 to 100, got %q", name, s))
+	}
+	*value = percent
+	return nil
+}
+
+// envDuration sets value from the environment variable name if it is set, which must be a
+// duration such as 5s, and unless positive is false, more than zero.
+func envDuration(name string, value *time.Duration, positive bool) error {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 || (positive && d == 0) {
+		if positive {
+			return errors.New(fmt.Sprintf("%v should be a positive duration, e.g. 5s, got %q", name, s))
+		}
+		return errors.New(fmt.Sprintf("%v should be a duration, e.g. 10s, got %q", name, s))
+	}
+	*value = d
+	return nil
+}
+
+// parseProxies parses the addresses or CIDR ranges of trusted proxies.
+func parseProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, errors.New(fmt.Sprintf("%q is not an IP address or CIDR range", proxy))
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%q is not an IP address or CIDR range", proxy))
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
@@ -0,0 +1,68 @@
+package employees
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadUploadConfig(t *testing.T) {
+	t.Setenv("UPLOAD_SPOOL_DIR", "/var/lib/employees/spool")
+	t.Setenv("UPLOAD_COLUMN_ALIASES", "staff_no=id")
+	t.Setenv("UPLOAD_BATCH_SIZE", "1000")
+	t.Setenv("UPLOAD_MAX_FILE_SIZE", "1048576")
+	t.Setenv("UPLOAD_MAX_SYNC_DELETE_PERCENT", "12.5")
+	t.Setenv("UPLOAD_DROP_DIR", "/srv/drop")
+	t.Setenv("UPLOAD_DROP_POLL_INTERVAL", "1m")
+	t.Setenv("UPLOAD_DROP_SETTLE_TIME", "0s")
+	t.Setenv("UPLOAD_TRUSTED_PROXIES", "10.0.0.1, 192.168.0.0/16,::1")
+
+	config, err := LoadUploadConfig()
+	if err != nil {
+		t.Fatalf("LoadUploadConfig() returned error %v", err)
+	}
+	want := DefaultUploadConfig()
+	want.SpoolDir = "/var/lib/employees/spool"
+	want.ColumnAliases["staff_no"] = "id"
+	want.BatchSize = 1000
+	want.MaxFileSize = 1 << 20
+	want.MaxSyncDeletePercent = 12.5
+	want.DropDir = "/srv/drop"
+	want.DropPollInterval = time.Minute
+	want.DropSettleTime = 0
+	want.TrustedProxies = []string{"10.0.0.1", "192.168.0.0/16", "::1"}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("LoadUploadConfig() = %+v, want %+v", config, want)
+	}
+}
+
+func TestLoadUploadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"UPLOAD_COLUMN_ALIASES", "staff_no"},
+		{"UPLOAD_BATCH_SIZE", "0"},
+		{"UPLOAD_MAX_FILE_SIZE", "64MiB"},
+		{"UPLOAD_MAX_ROWS", "-1"},
+		{"UPLOAD_MAX_FILES", "ten"},
+		{"UPLOAD_MAX_ARCHIVE_ENTRIES", "1.5"},
+		{"UPLOAD_MAX_EXPANDED_SIZE", "0"},
+		{"UPLOAD_MAX_COMPRESSION_RATIO", "0"},
+		{"UPLOAD_MAX_SYNC_DELETE_PERCENT", "101"},
+		{"UPLOAD_DROP_POLL_INTERVAL", "0s"},
+		{"UPLOAD_DROP_SETTLE_TIME", "-1s"},
+		{"UPLOAD_TRUSTED_PROXIES", "10.0.0.1,proxy.local"},
+		{"UPLOAD_TRUSTED_PROXIES", "10.0.0.0/33"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(test.name, test.value)
+			_, err := LoadUploadConfig()
+			if err == nil || !strings.Contains(err.Error(), test.name) {
+				t.Errorf("LoadUploadConfig() with %v=%q returned error %v, want one naming %v", test.name, test.value, err, test.name)
+			}
+		})
+	}
+}
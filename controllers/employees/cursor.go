@@ -0,0 +1,63 @@
+package employees
+
+import (
+	"awesomeProject/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/volatiletech/null/v8"
+)
+
+// pageCursor marks where a page of GET /users ended: the last employee of the page, and the sort
+// it was listed in, or the search it was ranked by. It is opaque to clients, who pass it back as is
+// to get the next page.
+type pageCursor struct {
+	Sort   string  `json:"sort"`
+	Search string  `json:"q,omitempty"`
+	ID     string  `json:"id"`
+	Login  string  `json:"login"`
+	Name   string  `json:"name"`
+	Salary float64 `json:"salary"`
+}
+
+// newPageCursor makes the cursor of a page ending with last. rankedBy is the search the page was
+// ranked by, if it was listed without a sort.
+func newPageCursor(sort string, rankedBy string, last *models.Employee) string {
+	cursor, _ := json.Marshal(pageCursor{
+		Sort:   sort,
+		Search: rankedBy,
+		ID:     last.ID,
+		Login:  last.Login,
+		Name:   last.Name,
+		Salary: last.Salary.Float64,
+	})
+	return base64.RawURLEncoding.EncodeToString(cursor)
+}
+
+// parsePageCursor returns the last employee of the page a cursor was made for. The cursor must
+// have been made for the same sort, or ranking by the same search, as it marks a position in that
+// order only.
+func parsePageCursor(cursor string, sort string, rankedBy string) (*models.Employee, error) {
+	var parsed pageCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(decoded, &parsed)
+	}
+	if err != nil || parsed.ID == "" {
+		return nil, errors.New("Invalid data format: cursor should be the nextCursor of an earlier page")
+	}
+	if parsed.Sort != sort {
+		return nil, errors.New(fmt.Sprintf("Invalid data format: cursor was made for sort=%v, leave out the cursor to list employees in another order", parsed.Sort))
+	}
+	if parsed.Search != rankedBy {
+		return nil, errors.New(fmt.Sprintf("Invalid data format: cursor was made for q=%v, leave out the cursor to search for something else", parsed.Search))
+	}
+	return &models.Employee{
+		ID:     parsed.ID,
+		Login:  parsed.Login,
+		Name:   parsed.Name,
+		Salary: null.Float64From(parsed.Salary),
+	}, nil
+}
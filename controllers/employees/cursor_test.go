@@ -0,0 +1,51 @@
+package employees
+
+import (
+	"awesomeProject/models"
+	"strings"
+	"testing"
+
+	"github.com/volatiletech/null/v8"
+)
+
+func TestPageCursor(t *testing.T) {
+	last := &models.Employee{ID: "e0002", Login: "rwesley", Name: "Ron Weasley", Salary: null.Float64From(19234.5)}
+	cursor := newPageCursor("-salary,+name", "", last)
+	got, err := parsePageCursor(cursor, "-salary,+name", "")
+	if err != nil {
+		t.Fatalf("parsePageCursor() returned error %v", err)
+	}
+	if got.ID != last.ID || got.Login != last.Login || got.Name != last.Name || got.Salary != last.Salary {
+		t.Errorf("parsePageCursor() = %v %v %q %v, want %v %v %q %v", got.ID, got.Login, got.Name, got.Salary.Float64,
+			last.ID, last.Login, last.Name, last.Salary.Float64)
+	}
+
+	ranked := newPageCursor("+id", "wes", last)
+	if _, err := parsePageCursor(ranked, "+id", "wes"); err != nil {
+		t.Errorf("parsePageCursor() returned error %v for a ranked page", err)
+	}
+}
+
+func TestPageCursorInvalid(t *testing.T) {
+	last := &models.Employee{ID: "e0002", Login: "rwesley", Name: "Ron Weasley"}
+	tests := []struct {
+		name     string
+		cursor   string
+		sort     string
+		rankedBy string
+		want     string
+	}{
+		{"not base64", "not a cursor!", "+id", "", "nextCursor of an earlier page"},
+		{"not JSON", "bm90IGpzb24", "+id", "", "nextCursor of an earlier page"},
+		{"no ID", "e30", "+id", "", "nextCursor of an earlier page"},
+		{"other sort", newPageCursor("+name", "", last), "+id", "", "cursor was made for sort=+name"},
+		{"other search", newPageCursor("+id", "ron", last), "+id", "wes", "cursor was made for q=ron"},
+		{"search dropped", newPageCursor("+id", "ron", last), "+id", "", "cursor was made for q=ron"},
+	}
+	for _, test := range tests {
+		_, err := parsePageCursor(test.cursor, test.sort, test.rankedBy)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("parsePageCursor(%v) returned error %v, want one containing %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package employees
+
+import (
+	"awesomeProject/domains"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+// Subdirectories of the drop folder. Files are moved to processing/ once they are queued, named
+// after their job, and on to processed/ or failed/ once the job has finished.
+const (
+	dropProcessing = "processing"
+	dropProcessed  = "processed"
+	dropFailed     = "failed"
+)
+
+// uuidLength is the length of a job ID.
+const uuidLength = 36
+
+// dropUploader identifies the files of the drop folder in the upload history.
+const dropUploader = "drop-folder"
+
+// droppedFile is how a file in the drop folder looked since it was first seen that way.
+type droppedFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// StartDropFolderWorker starts watching the drop folder for CSV files, if one is configured, for
+// systems that can write files to a shared directory but cannot call the API. Each file is queued
+// as an upload job with the default options, and processed by the upload worker like an uploaded
+// file.
+func (h *employeeHandler) StartDropFolderWorker() error {
+	if h.uploadConfig.DropDir == "" {
+		return nil
+	}
+	for _, dir := range []string{dropProcessing, dropProcessed, dropFailed} {
+		if err := os.MkdirAll(filepath.Join(h.uploadConfig.DropDir, dir), 0700); err != nil {
+			return err
+		}
+	}
+	go h.runDropFolderWorker()
+	return nil
+}
+
+func (h *employeeHandler) runDropFolderWorker() {
+	seen := make(map[string]droppedFile)
+	for {
+		h.finishDroppedFiles()
+		h.queueSettledFiles(seen)
+		time.Sleep(h.uploadConfig.DropPollInterval)
+	}
+}
+
+// queueSettledFiles queues the CSV files of the drop folder whose size and modification time have
+// not changed for DropSettleTime, so that a file is never read while it is still being written.
+func (h *employeeHandler) queueSettledFiles(seen map[string]droppedFile) {
+	entries, err := os.ReadDir(h.uploadConfig.DropDir)
+	if err != nil {
+		log.Error().Err(err).Str("dropDir", h.uploadConfig.DropDir).Msg("Failed to read the drop folder")
+		return
+	}
+	now := time.Now()
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !isDroppedCSV(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// removed since the folder was read
+			continue
+		}
+		present[name] = true
+
+		last, ok := seen[name]
+		if !ok || last.size != info.Size() || !last.modTime.Equal(info.ModTime()) {
+			seen[name] = droppedFile{size: info.Size(), modTime: info.ModTime(), since: now}
+			continue
+		}
+		if now.Sub(last.since) < h.uploadConfig.DropSettleTime {
+			continue
+		}
+		delete(seen, name)
+		h.queueDroppedFile(name)
+	}
+	for name := range seen {
+		if !present[name] {
+			delete(seen, name)
+		}
+	}
+}
+
+// isDroppedCSV ignores hidden files and files without a .csv extension, so writers can write to a
+// temporary name and rename the file once it is complete.
+func isDroppedCSV(name string) bool {
+	return !strings.HasPrefix(name, ".") && strings.EqualFold(filepath.Ext(name), ".csv")
+}
+
+func (h *employeeHandler) queueDroppedFile(name string) {
+	job, err := newUploadJob(domains.UploadOptions{Policy: domains.PolicyUpsert}, dropUploader, "")
+	if err != nil {
+		log.Error().Err(err).Str("file", name).Msg("Failed to create an upload job for a dropped file")
+		return
+	}
+	processing := filepath.Join(h.uploadConfig.DropDir, dropProcessing, job.ID+"-"+name)
+	if err := os.Rename(filepath.Join(h.uploadConfig.DropDir, name), processing); err != nil {
+		log.Error().Err(err).Str("file", name).Msg("Failed to move a dropped file")
+		return
+	}
+	h.startDroppedJob(&job, processing, name)
+}
+
+// startDroppedJob spools a file moved to processing/ and queues its job. A file that cannot be
+// spooled, e.g. because it exceeds the limits, fails straight away. A job that cannot be saved is
+// tried again on the next poll.
+func (h *employeeHandler) startDroppedJob(job *domains.UploadJob, path string, name string) {
+	contentHash, err := h.spoolDroppedFile(job, path)
+	if err == nil {
+		job.Files = []domains.UploadFile{{Filename: name, ContentHash: contentHash}}
+		if err := h.addUploadJob(job); err != nil {
+			h.removeSpooledFiles(job.ID, 1)
+			log.Error().Err(err).Str("file", name).Msg("Failed to queue a dropped file")
+		}
+		return
+	}
+
+	h.removeSpooledFiles(job.ID, 1)
+	finishedAt := time.Now().UTC()
+	job.State = domains.UploadJobFailed
+	job.Error = err.Error()
+	job.FinishedAt = &finishedAt
+	job.Files = []domains.UploadFile{{Filename: name, Status: domains.UploadFileFailed, Error: err.Error()}}
+	h.moveDroppedFile(path, job)
+}
+
+func (h *employeeHandler) spoolDroppedFile(job *domains.UploadJob, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	src := &limitedReader{r: file, limit: h.uploadConfig.MaxFileSize}
+	return spool(src, h.spoolPath(job.ID, 0), func(r io.Reader) error {
+		return countRows(r, job.Options.Charset, h.uploadConfig.ColumnAliases, h.uploadConfig.MaxRows)
+	})
+}
+
+// finishDroppedFiles moves the files in processing/ whose job has finished, and queues the files
+// whose job was never saved because the service stopped in between.
+func (h *employeeHandler) finishDroppedFiles() {
+	dir := filepath.Join(h.uploadConfig.DropDir, dropProcessing)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Error().Err(err).Str("dropDir", h.uploadConfig.DropDir).Msg("Failed to read the drop folder")
+		return
+	}
+	for _, entry := range entries {
+		jobID, name, ok := parseProcessingName(entry.Name())
+		if !ok {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		job, err := h.uploadJobsDAO.GetByID(boil.GetDB(), jobID)
+		if errors.Is(err, sql.ErrNoRows) {
+			job, err := newUploadJob(domains.UploadOptions{Policy: domains.PolicyUpsert}, dropUploader, "")
+			if err != nil {
+				log.Error().Err(err).Str("file", name).Msg("Failed to create an upload job for a dropped file")
+				continue
+			}
+			job.ID = jobID
+			h.removeSpooledFiles(job.ID, 1)
+			h.startDroppedJob(&job, path, name)
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Str("jobID", jobID).Msg("Failed to fetch the upload job of a dropped file")
+			continue
+		}
+		if job.State == domains.UploadJobQueued || job.State == domains.UploadJobRunning {
+			continue
+		}
+		h.moveDroppedFile(path, job)
+	}
+}
+
+// parseProcessingName splits the name of a file in processing/ into its job ID and the name it
+// was dropped with.
+func parseProcessingName(name string) (string, string, bool) {
+	if len(name) <= uuidLength+1 || name[uuidLength] != '-' {
+		return "", "", false
+	}
+	jobID := name[:uuidLength]
+	if _, err := uuid.FromString(jobID); err != nil {
+		return "", "", false
+	}
+	return jobID, name[uuidLength+1:], true
+}
+
+// moveDroppedFile moves a file whose job has finished to processed/ if it succeeded, or else to
+// failed/, next to the job as a JSON file with the same name and a .json extension added.
+func (h *employeeHandler) moveDroppedFile(path string, job *domains.UploadJob) {
+	dir := dropFailed
+	if job.State == domains.UploadJobSucceeded {
+		dir = dropProcessed
+	}
+	dst := filepath.Join(h.uploadConfig.DropDir, dir, filepath.Base(path))
+
+	result, err := json.MarshalIndent(job, "", "    ")
+	if err == nil {
+		err = os.WriteFile(dst+".json", append(result, '\n'), 0600)
+	}
+	if err == nil {
+		err = os.Rename(path, dst)
+	}
+	if err != nil {
+		// left in processing/ to be moved on the next poll
+		log.Error().Err(err).Str("jobID", job.ID).Msg("Failed to move a dropped file")
+	}
+}
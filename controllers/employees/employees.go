@@ -4,12 +4,8 @@ import (
 	"awesomeProject/daos"
 	"awesomeProject/domains"
 	"awesomeProject/models"
-	"awesomeProject/utils/db"
-	"bufio"
 	"errors"
 	"fmt"
-	"io"
-	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
@@ -24,12 +20,22 @@ type Handler interface {
 }
 
 type employeeHandler struct {
-	employeesDAO daos.EmployeesDAO
+	employeesDAO  daos.EmployeesDAO
+	uploadJobsDAO daos.UploadJobsDAO
+	uploadsDAO    daos.UploadsDAO
+	uploadConfig  UploadConfig
+	jobQueued     chan struct{}
+	streams       chan *uploadStream
 }
 
-func NewHandler(employeeDAO daos.EmployeesDAO) *employeeHandler {
+func NewHandler(employeeDAO daos.EmployeesDAO, uploadJobsDAO daos.UploadJobsDAO, uploadsDAO daos.UploadsDAO, uploadConfig UploadConfig) *employeeHandler {
 	return &employeeHandler{
 		employeeDAO,
+		uploadJobsDAO,
+		uploadsDAO,
+		uploadConfig,
+		make(chan struct{}, 1),
+		make(chan *uploadStream),
 	}
 }
 
@@ -37,8 +43,15 @@ func (h *employeeHandler) RouteGroup(r *gin.Engine) {
 	rg := r.Group("/users")
 	rg.DELETE("/:empID", h.delete)
 	rg.GET("", h.get)
+	rg.GET("/export", h.export)
 	rg.GET("/:empID", h.getByID)
 	rg.POST("/upload", h.uploadCSV)
+	rg.POST("/import", h.importJSON)
+	rg.GET("/upload/:jobID", h.getUploadJob)
+	rg.GET("/uploads", h.getUploads)
+	rg.GET("/uploads/:uploadID", h.getUploadByID)
+	rg.GET("/uploads/:uploadID/rejects", h.getRejects)
+	rg.POST("/uploads/:uploadID/revert", h.revertUpload)
 	rg.POST("", h.create)
 	rg.PUT("/:empID", h.update)
 
@@ -55,87 +68,91 @@ func (h *employeeHandler) delete(c *gin.Context) {
 }
 
 func (h *employeeHandler) get(c *gin.Context) {
-	var minSalary, maxSalary null.Float64
-	var sort, order null.String
 	var limit, offset int
 	limit = 30
 	offset = 0
 
-	minSalaryString, present := c.GetQuery("minSalary")
-	if present && minSalaryString != "" {
-		minSalaryFloat64, err := strconv.ParseFloat(minSalaryString, 64)
-		if err != nil {
-			c.Error(err)
-			c.JSON(http.StatusBadRequest, c.Errors.Last())
-			return
-		}
-		minSalary = null.Float64From(minSalaryFloat64)
+	minSalary, maxSalary, search, sort, err := parseEmployeeFilters(c)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
 	}
 
-	maxSalaryString, present := c.GetQuery("maxSalary")
-	if present && maxSalaryString != "" {
-		maxSalaryFloat64, err := strconv.ParseFloat(maxSalaryString, 64)
-		if err != nil {
-			c.Error(err)
+	limitString, present := c.GetQuery("limit")
+	if present && limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 0 {
+			c.Error(errors.New("Invalid data format: limit should be a non-negative integer"))
 			c.JSON(http.StatusBadRequest, c.Errors.Last())
 			return
 		}
-		maxSalary = null.Float64From(maxSalaryFloat64)
 	}
 
-	sortString, present := c.GetQuery("sort")
-	if present && sortString != "" {
-		symbol := sortString[:1]
-		if symbol == "+" {
-			order = null.StringFrom("asc")
-		} else if symbol == "-" {
-			order = null.StringFrom("desc")
-		} else {
-			c.Error(errors.New("Invalid data format: Order should be represented by %2B (+) (ascending) or - (descending)"))
+	offsetString, present := c.GetQuery("offset")
+	if present && offsetString != "" {
+		offset, err = strconv.Atoi(offsetString)
+		if err != nil || offset < 0 {
+			c.Error(errors.New("Invalid data format: offset should be a non-negative integer"))
 			c.JSON(http.StatusBadRequest, c.Errors.Last())
 			return
 		}
+	}
 
-		col := sortString[1:]
-		if col != "id" && col != "name" && col != "login" && col != "salary" {
-			// invalid sort key
-			c.Error(errors.New("Invalid data format: Only columns \"id\", \"name\", \"login\" or \"salary\" can be sorted"))
+	// a cursor marks a position in the order of a sort, which it must be used with
+	sortSpec := formatSort(sort)
+	var rankedBy string
+	if len(sort) == 0 {
+		// without a sort, employees found by a search are ranked by how well they match
+		rankedBy = search
+	}
+	var after *models.Employee
+	cursor := c.Query("cursor")
+	if cursor != "" {
+		if present && offsetString != "" {
+			c.Error(errors.New("Invalid data format: offset cannot be used with cursor"))
 			c.JSON(http.StatusBadRequest, c.Errors.Last())
 			return
-		} else {
-			sort = null.StringFrom(col)
 		}
-	}
-
-	var err error
-	limitString, present := c.GetQuery("limit")
-	if present && limitString != "" {
-		limit, err = strconv.Atoi(limitString)
+		after, err = parsePageCursor(cursor, sortSpec, rankedBy)
 		if err != nil {
-			c.Error(errors.New("Invalid data format: limit should be an integer"))
+			c.Error(err)
 			c.JSON(http.StatusBadRequest, c.Errors.Last())
 			return
 		}
 	}
 
-	offsetString, present := c.GetQuery("offset")
-	if present && offsetString != "" {
-		offset, err = strconv.Atoi(offsetString)
-		if err != nil {
-			c.Error(errors.New("Invalid data format: offset should be an integer"))
-			c.JSON(http.StatusBadRequest, c.Errors.Last())
-			return
+	total, err := h.employeesDAO.Count(boil.GetDB(), minSalary, maxSalary, search)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+	var employeeSlice models.EmployeeSlice
+	var hasMore bool
+	if cursor != "" {
+		// one more than the page shows whether there is a next page
+		employeeSlice, err = h.employeesDAO.GetAfter(boil.GetDB(), minSalary, maxSalary, search, sort, after, limit+1)
+		if len(employeeSlice) > limit {
+			hasMore = true
+			employeeSlice = employeeSlice[:limit]
+		}
+	} else {
+		var page *models.EmployeeSlice
+		page, err = h.employeesDAO.GetAll(boil.GetDB(), minSalary, maxSalary, search, sort, limit, offset)
+		if page != nil {
+			employeeSlice = *page
 		}
+		hasMore = int64(offset+limit) < total
 	}
-
-	employeeSlice, err := h.employeesDAO.GetAll(boil.GetDB(), minSalary, maxSalary, sort, order, limit, offset)
 	if err != nil {
 		c.Error(err)
 		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
 	}
 
-	var employeeList []domains.Employee
-	for _, employee := range *employeeSlice {
+	employeeList := make([]domains.Employee, 0, len(employeeSlice))
+	for _, employee := range employeeSlice {
 		e := domains.Employee{
 			ID:     employee.ID,
 			Name:   employee.Name,
@@ -147,10 +164,83 @@ func (h *employeeHandler) get(c *gin.Context) {
 
 	response := &domains.AllEmployeeResp{
 		Results: employeeList,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+	var links []string
+	if limit > 0 && hasMore && len(employeeSlice) > 0 {
+		response.NextCursor = newPageCursor(sortSpec, rankedBy, employeeSlice[len(employeeSlice)-1])
+		if cursor != "" {
+			response.Next = cursorLink(c, response.NextCursor, limit)
+		} else {
+			response.Next = pageLink(c, offset+limit, limit)
+		}
+		links = append(links, fmt.Sprintf(`<%v>; rel="next"`, response.Next))
+	}
+	if limit > 0 && offset > 0 {
+		prevOffset := offset - limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		response.Prev = pageLink(c, prevOffset, limit)
+		links = append(links, fmt.Sprintf(`<%v>; rel="prev"`, response.Prev))
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
 	}
 	c.JSON(http.StatusOK, &response)
 }
 
+// pageLink links to another page of the same list, keeping the filters and sort of the request.
+func pageLink(c *gin.Context, offset int, limit int) string {
+	query := c.Request.URL.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	return c.Request.URL.Path + "?" + query.Encode()
+}
+
+// cursorLink links to the page after a cursor, keeping the filters and sort of the request.
+func cursorLink(c *gin.Context, cursor string, limit int) string {
+	query := c.Request.URL.Query()
+	query.Set("cursor", cursor)
+	query.Set("limit", strconv.Itoa(limit))
+	return c.Request.URL.Path + "?" + query.Encode()
+}
+
+// parseEmployeeFilters reads the salary range, search and sort order shared by GET /users and the
+// export.
+func parseEmployeeFilters(c *gin.Context) (minSalary null.Float64, maxSalary null.Float64, search string, sort []domains.SortKey, err error) {
+	minSalaryString, present := c.GetQuery("minSalary")
+	if present && minSalaryString != "" {
+		minSalaryFloat64, err := strconv.ParseFloat(minSalaryString, 64)
+		if err != nil {
+			return minSalary, maxSalary, search, sort, err
+		}
+		minSalary = null.Float64From(minSalaryFloat64)
+	}
+
+	maxSalaryString, present := c.GetQuery("maxSalary")
+	if present && maxSalaryString != "" {
+		maxSalaryFloat64, err := strconv.ParseFloat(maxSalaryString, 64)
+		if err != nil {
+			return minSalary, maxSalary, search, sort, err
+		}
+		maxSalary = null.Float64From(maxSalaryFloat64)
+	}
+
+	search = strings.TrimSpace(c.Query("q"))
+
+	sortString, present := c.GetQuery("sort")
+	if present && sortString != "" {
+		sort, err = parseSort(sortString)
+		if err != nil {
+			return minSalary, maxSalary, search, sort, err
+		}
+	}
+	return minSalary, maxSalary, search, sort, nil
+}
+
 func (h *employeeHandler) getByID(c *gin.Context) {
 	empID := c.Param("empID")
 	employee, err := h.employeesDAO.GetByID(boil.GetDB(), empID)
@@ -203,75 +293,3 @@ func (h *employeeHandler) update(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, updatedEmployee)
 }
-
-func (h *employeeHandler) uploadCSV(c *gin.Context) {
-	form, _ := c.MultipartForm()
-	files := form.File["file"]
-
-	var employeesAdded int
-	for _, file := range files {
-		csv, err := file.Open()
-		if err != nil {
-			c.Error(err)
-			c.JSON(http.StatusBadRequest, c.Errors.Last())
-			return
-		}
-		success, err := h.ProcessCSV(csv)
-		employeesAdded += success
-
-		if err != nil {
-			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{fmt.Sprintf("Error uploading %v", file.Filename): c.Errors})
-		}
-		csv.Close()
-	}
-	c.JSON(http.StatusOK, gin.H{"Success": fmt.Sprintf("Number of employees inserted : %v", employeesAdded)})
-}
-
-func (h *employeeHandler) ProcessCSV(file multipart.File) (int, error) {
-	br := bufio.NewReader(file)
-	employeesAdded := 0
-
-	if err := db.WithTxn(func(txn boil.Transactor) (err error) {
-		for {
-			s, eofErr := br.ReadString('\n')
-			if eofErr != nil && !errors.Is(eofErr, io.EOF) {
-				return eofErr
-			}
-
-			if len(s) > 0 && s[0] != '#' {
-				cols := strings.Split(s, ",")
-
-				if len(cols) != 4 {
-					return errors.New(fmt.Sprintf("Missing employee fields: ID, login, name and salary fields are all required"))
-				}
-
-				salary, err := strconv.ParseFloat(strings.TrimSuffix(cols[3], "\n"), 64)
-				if err != nil || salary < 0 {
-					return errors.New(fmt.Sprintf("Invalid employee field: Salary should be a decimal that is > 0.0 for employee where id = %v", cols[0]))
-				}
-
-				if err := h.employeesDAO.UpsertEmployee(txn, models.Employee{
-					ID:     cols[0],
-					Login:  cols[1],
-					Name:   cols[2],
-					Salary: null.Float64From(salary),
-				}); err != nil {
-					return err
-				}
-				employeesAdded++
-			}
-			if errors.Is(eofErr, io.EOF) {
-				break
-			}
-		}
-		return
-	}); err != nil {
-		return 0, err
-	}
-	if employeesAdded == 0 {
-		return 0, errors.New(fmt.Sprintf("Employees Added is 0 : empty file was uploaded"))
-	}
-
-	return employeesAdded, nil
-}
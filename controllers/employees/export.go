@@ -0,0 +1,164 @@
+package employees
+
+import (
+	"awesomeProject/domains"
+	"awesomeProject/models"
+	"awesomeProject/utils/csvreader"
+	"awesomeProject/utils/xlsx"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+const (
+	formatCSV  = "csv"
+	formatXLSX = "xlsx"
+)
+
+// employeeWriter writes employees in one of the export formats.
+type employeeWriter interface {
+	Write(employee *models.Employee) error
+	Close() error
+}
+
+// export streams every employee matching the filters of GET /users, in a format that can be
+// uploaded again as is. Employees are written as they are read from the database, so the export
+// never holds more than one of them in memory.
+func (h *employeeHandler) export(c *gin.Context) {
+	format := c.DefaultQuery("format", formatCSV)
+	var contentType string
+	switch format {
+	case formatCSV:
+		contentType = "text/csv; charset=utf-8"
+	case formatNDJSON:
+		contentType = "application/x-ndjson"
+	case formatXLSX:
+		contentType = xlsx.ContentType
+	default:
+		c.Error(errors.New("Invalid data format: format should be \"csv\", \"ndjson\" or \"xlsx\""))
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+
+	minSalary, maxSalary, search, sort, err := parseEmployeeFilters(c)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+
+	// the response starts with the first employee, so that a query that fails straight away can
+	// still be reported as an error
+	var writer employeeWriter
+	started := false
+	start := func() (err error) {
+		started = true
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="employees.`+format+`"`)
+		c.Status(http.StatusOK)
+		writer, err = newEmployeeWriter(c.Writer, format)
+		return err
+	}
+	err = h.employeesDAO.EachEmployee(boil.GetDB(), minSalary, maxSalary, search, sort, func(employee *models.Employee) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return writer.Write(employee)
+	})
+	if err != nil && !started {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+
+	// the response has started, so errors from here on can only be logged
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to export employees")
+	}
+}
+
+func newEmployeeWriter(w io.Writer, format string) (employeeWriter, error) {
+	switch format {
+	case formatNDJSON:
+		buffered := bufio.NewWriter(w)
+		return &ndjsonEmployeeWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	case formatXLSX:
+		writer, err := xlsx.NewWriter(w, "Employees")
+		if err != nil {
+			return nil, err
+		}
+		if err := writer.Write(employeeColumns[0], employeeColumns[1], employeeColumns[2], employeeColumns[3]); err != nil {
+			return nil, err
+		}
+		return &xlsxEmployeeWriter{writer}, nil
+	default:
+		writer := &csvEmployeeWriter{buffered: bufio.NewWriter(w)}
+		if _, err := writer.buffered.WriteString(csvreader.Join(employeeColumns, ',') + "\n"); err != nil {
+			return nil, err
+		}
+		return writer, nil
+	}
+}
+
+// csvEmployeeWriter writes a header row followed by one row per employee, in the column order
+// ProcessCSV expects.
+type csvEmployeeWriter struct {
+	buffered *bufio.Writer
+}
+
+func (w *csvEmployeeWriter) Write(employee *models.Employee) error {
+	fields := []string{employee.ID, employee.Login, employee.Name, strconv.FormatFloat(employee.Salary.Float64, 'f', -1, 64)}
+	_, err := w.buffered.WriteString(csvreader.Join(fields, ',') + "\n")
+	return err
+}
+
+func (w *csvEmployeeWriter) Close() error {
+	return w.buffered.Flush()
+}
+
+// ndjsonEmployeeWriter writes one JSON object per employee and line, as accepted by
+// POST /users/import.
+type ndjsonEmployeeWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (w *ndjsonEmployeeWriter) Write(employee *models.Employee) error {
+	return w.encoder.Encode(domains.Employee{
+		ID:     employee.ID,
+		Name:   employee.Name,
+		Login:  employee.Login,
+		Salary: employee.Salary.Float64,
+	})
+}
+
+func (w *ndjsonEmployeeWriter) Close() error {
+	return w.buffered.Flush()
+}
+
+type xlsxEmployeeWriter struct {
+	writer *xlsx.Writer
+}
+
+func (w *xlsxEmployeeWriter) Write(employee *models.Employee) error {
+	return w.writer.Write(employee.ID, employee.Login, employee.Name, employee.Salary.Float64)
+}
+
+func (w *xlsxEmployeeWriter) Close() error {
+	return w.writer.Close()
+}
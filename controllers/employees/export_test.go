@@ -0,0 +1,72 @@
+package employees
+
+import (
+	"awesomeProject/models"
+	"awesomeProject/utils/csvreader"
+	"awesomeProject/utils/xlsx"
+	"bytes"
+	"testing"
+
+	"github.com/volatiletech/null/v8"
+)
+
+// TestExportUpload exports employees and reads the export back the way an upload is read, which
+// must give the same employees.
+func TestExportUpload(t *testing.T) {
+	employees := []*models.Employee{
+		{ID: "e0001", Login: "hpotter", Name: "Harry Potter", Salary: null.Float64From(1234)},
+		{ID: "e0002", Login: "rwesley", Name: `Ron "Ronald" Weasley, <&>`, Salary: null.Float64From(19234.5)},
+		{ID: "e0003", Login: "zoë", Name: "Zoë Ğ", Salary: null.Float64From(0)},
+		{ID: "e0004", Login: "ssnape", Name: "Severus Snape", Salary: null.Float64From(0.01)},
+	}
+
+	for _, format := range []string{formatCSV, formatXLSX} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := newEmployeeWriter(&buf, format)
+			if err != nil {
+				t.Fatalf("newEmployeeWriter() returned error %v", err)
+			}
+			for _, employee := range employees {
+				if err := writer.Write(employee); err != nil {
+					t.Fatalf("Write() returned error %v", err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close() returned error %v", err)
+			}
+
+			var reader recordReader
+			if format == formatXLSX {
+				workbook, err := xlsx.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "", nil)
+				if err != nil {
+					t.Fatalf("xlsx.NewReader() returned error %v", err)
+				}
+				defer workbook.Close()
+				reader = &xlsxRecordReader{Reader: workbook}
+			} else {
+				reader = csvreader.NewReader(&buf)
+			}
+			file, rows, err := readEmployeeRows(reader, DefaultColumnAliases, 100)
+			if err != nil {
+				t.Fatalf("readEmployeeRows() returned error %v", err)
+			}
+			if len(file.errors) > 0 {
+				t.Fatalf("readEmployeeRows() returned row errors %v", file.errors)
+			}
+			if file.header == nil {
+				t.Error("the header row of the export was not detected")
+			}
+			if len(rows) != len(employees) {
+				t.Fatalf("readEmployeeRows() read %v rows, want %v", len(rows), len(employees))
+			}
+			for i, row := range rows {
+				got, want := row.Employee, employees[i]
+				if got.ID != want.ID || got.Login != want.Login || got.Name != want.Name || got.Salary != want.Salary {
+					t.Errorf("row %v = %v %v %q %v, want %v %v %q %v", i, got.ID, got.Login, got.Name, got.Salary.Float64,
+						want.ID, want.Login, want.Name, want.Salary.Float64)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package employees
+
+import (
+	"awesomeProject/domains"
+	"awesomeProject/utils/charset"
+	"awesomeProject/utils/csvreader"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+func (h *employeeHandler) importJSON(c *gin.Context) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	var format string
+	switch mediaType {
+	case "application/json":
+		format = formatJSON
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		format = formatNDJSON
+	default:
+		c.Error(errors.New("Unsupported Content-Type: use application/json for an array of employees or application/x-ndjson for one employee per line"))
+		c.JSON(http.StatusUnsupportedMediaType, c.Errors.Last())
+		return
+	}
+
+	options, err := parseUploadOptions(c)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+	options.Format = format
+
+	uploader, uploaderIP := h.uploaderIdentity(c)
+	job, err := newUploadJob(options, uploader, uploaderIP)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, c.Errors.Last())
+		return
+	}
+	body := &limitedReader{r: c.Request.Body, limit: h.uploadConfig.MaxFileSize}
+	stream, err := h.startStream(c, job, "import."+format, body)
+	if err != nil {
+		if stream != nil {
+			stream.reject(err)
+		}
+		c.Error(err)
+		c.JSON(uploadErrorStatus(err), c.Errors.Last())
+		return
+	}
+	c.JSON(http.StatusAccepted, stream.accept(nil))
+}
+
+// ProcessJSON processes a JSON array of employees, or one employee per line for NDJSON, through
+// the same validation and upsert path as ProcessCSV. Row errors refer to the position of the
+// employee in the array, or to the line for NDJSON. Like CSV files, the JSON is transcoded to
+// UTF-8 from the charset of the options, or else from the encoding detected from its content, as
+// encoding/json would silently replace the text it cannot read. beforeCommit is called as it is
+// by ProcessCSV.
+func (h *employeeHandler) ProcessJSON(file io.Reader, uploadID int64, options domains.UploadOptions, beforeCommit func() error) (*domains.UploadResult, error) {
+	reader, err := newJSONRecordReader(file, options)
+	if err != nil {
+		return nil, encodingError(err)
+	}
+	result, err := h.processRecords(reader, uploadID, options, beforeCommit)
+	if err != nil {
+		return nil, encodingError(err)
+	}
+	return result, nil
+}
+
+// jsonEmployee is decoded leniently so that a missing or malformed field is reported by the same
+// validation as a CSV field.
+type jsonEmployee struct {
+	ID     string      `json:"id"`
+	Login  string      `json:"login"`
+	Name   string      `json:"name"`
+	Salary json.Number `json:"salary"`
+}
+
+// jsonRecordReader reads employees as records laid out like a CSV file with a header row.
+type jsonRecordReader struct {
+	decoder    *json.Decoder // JSON array
+	lines      *bufio.Reader // NDJSON
+	headerRead bool
+	line       int
+}
+
+// newJSONRecordReader reads the JSON array, or the NDJSON, of a file in the format of the options,
+// transcoded to UTF-8.
+func newJSONRecordReader(file io.Reader, options domains.UploadOptions) (*jsonRecordReader, error) {
+	text, err := charset.NewReader(file, options.Charset)
+	if err != nil {
+		return nil, err
+	}
+	reader := &jsonRecordReader{}
+	if options.Format == formatNDJSON {
+		reader.lines = bufio.NewReader(text)
+		return reader, nil
+	}
+	reader.decoder = json.NewDecoder(text)
+	if err := expectDelim(reader.decoder, '['); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (r *jsonRecordReader) Read() (*csvreader.Record, error) {
+	if !r.headerRead {
+		// map the fields by name, so the ID of an employee can never be mistaken for a header
+		r.headerRead = true
+		return &csvreader.Record{Fields: employeeColumns, Raw: csvreader.Join(employeeColumns, ',')}, nil
+	}
+
+	raw, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+
+	var employee jsonEmployee
+	if err := json.Unmarshal(raw, &employee); err != nil {
+		return nil, &csvreader.ParseError{Line: r.line, Raw: string(raw), Err: errors.New(fmt.Sprintf("invalid employee: %v", err))}
+	}
+	fields := []string{strings.TrimSpace(employee.ID), strings.TrimSpace(employee.Login), strings.TrimSpace(employee.Name), employee.Salary.String()}
+	return &csvreader.Record{
+		Line:   r.line,
+		Fields: fields,
+		Raw:    csvreader.Join(fields, ','), // as CSV, so rejected employees can be listed with rejected CSV rows
+	}, nil
+}
+
+// next returns the raw JSON of the next employee.
+func (r *jsonRecordReader) next() (json.RawMessage, error) {
+	if r.decoder != nil {
+		if !r.decoder.More() {
+			if err := expectDelim(r.decoder, ']'); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		r.line++
+		var raw json.RawMessage
+		if err := r.decoder.Decode(&raw); err != nil {
+			if isDecodeError(err) {
+				return nil, err
+			}
+			return nil, errors.New(fmt.Sprintf("Invalid JSON: employee %v: %v", r.line, err))
+		}
+		return raw, nil
+	}
+
+	for {
+		line, err := r.lines.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, err
+		}
+		r.line++
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		// a byte order mark has been dropped with the charset
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			return line, nil
+		}
+	}
+}
+
+// Comments always returns 0, as JSON has no comments.
+func (r *jsonRecordReader) Comments() int {
+	return 0
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if isDecodeError(err) {
+		return err
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("Invalid JSON: %v", err))
+	}
+	if token != delim {
+		return errors.New(fmt.Sprintf("Invalid JSON: expected %v but found %v", delim, token))
+	}
+	return nil
+}
+
+// isDecodeError reports whether err is text that is not valid in the encoding of the JSON, which
+// is reported as such rather than as invalid JSON.
+func isDecodeError(err error) bool {
+	var decodeErr *charset.DecodeError
+	return errors.As(err, &decodeErr)
+}
@@ -0,0 +1,113 @@
+package employees
+
+import (
+	"awesomeProject/domains"
+	"awesomeProject/utils/charset"
+	"awesomeProject/utils/csvreader"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// TestImportRejects reads the rejects file of a JSON import back the way an upload is read, which
+// must map the columns by its header so the rejected employees can be fixed and uploaded again.
+func TestImportRejects(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+	}{
+		{formatJSON, `[{"id": "e0001", "login": "hpotter", "name": "Harry Potter", "salary": 1234},
+			{"id": "e0002", "login": "rwesley", "name": "Ron, Weasley", "salary": -1},
+			{"id": "e0003", "name": "Hermione Granger", "salary": 1}]`},
+		{formatNDJSON, `{"id": "e0001", "login": "hpotter", "name": "Harry Potter", "salary": 1234}
+{"id": "e0002", "login": "rwesley", "name": "Ron, Weasley", "salary": -1}
+{"id": "e0003", "name": "Hermione Granger", "salary": 1}`},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			reader, err := newJSONRecordReader(strings.NewReader(test.input), domains.UploadOptions{Format: test.format})
+			if err != nil {
+				t.Fatalf("newJSONRecordReader() returned error %v", err)
+			}
+			file, _, err := readEmployeeRows(reader, DefaultColumnAliases, 100)
+			if err != nil {
+				t.Fatalf("readEmployeeRows() returned error %v", err)
+			}
+			if len(file.rejected) != 2 {
+				t.Fatalf("readEmployeeRows() rejected %v rows, want 2", len(file.rejected))
+			}
+
+			rejects := file.rejectsCSV(reader)
+			reread, _, err := readEmployeeRows(csvreader.NewReader(strings.NewReader(rejects)), DefaultColumnAliases, 100)
+			if err != nil {
+				t.Fatalf("readEmployeeRows() returned error %v for the rejects file %q", err, rejects)
+			}
+			if reread.header == nil {
+				t.Errorf("the header row of the rejects file %q was not detected", rejects)
+			}
+			// the rows are read as they were, failing again for the same fields
+			var fields []string
+			for _, rowError := range reread.errors {
+				fields = append(fields, rowError.Field)
+			}
+			if strings.Join(fields, ",") != "salary,login" {
+				t.Errorf("the rejects file %q failed for fields %q, want salary and login", rejects, fields)
+			}
+		})
+	}
+}
+
+func TestJSONRecordReaderCharset(t *testing.T) {
+	tests := []struct {
+		name    string
+		options domains.UploadOptions
+		input   string
+		want    string // name of the employee read
+	}{
+		{"UTF-8", domains.UploadOptions{Format: formatJSON}, `[{"id": "e0001", "login": "zoe", "name": "Zoë", "salary": 1}]`, "Zoë"},
+		{"Windows-1252", domains.UploadOptions{Format: formatJSON, Charset: charset.Windows1252}, "[{\"id\": \"e0001\", \"login\": \"zoe\", \"name\": \"Zo\xEB\", \"salary\": 1}]", "Zoë"},
+		{"Windows-1252 detected", domains.UploadOptions{Format: formatNDJSON}, "{\"id\": \"e0001\", \"login\": \"zoe\", \"name\": \"Zo\xEB\", \"salary\": 1}", "Zoë"},
+		{"UTF-16LE", domains.UploadOptions{Format: formatNDJSON}, "\xFF\xFE" + utf16LE(`{"id": "e0001", "login": "zoe", "name": "Zoë 😀", "salary": 1}`), "Zoë 😀"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := newJSONRecordReader(strings.NewReader(test.input), test.options)
+			if err != nil {
+				t.Fatalf("newJSONRecordReader() returned error %v", err)
+			}
+			file, rows, err := readEmployeeRows(reader, DefaultColumnAliases, 100)
+			if err != nil {
+				t.Fatalf("readEmployeeRows() returned error %v", err)
+			}
+			if len(rows) != 1 || rows[0].Employee.Name != test.want {
+				t.Errorf("readEmployeeRows() read %v, errors %v, want an employee named %v", rows, file.errors, test.want)
+			}
+		})
+	}
+}
+
+func TestJSONRecordReaderInvalidEncoding(t *testing.T) {
+	var decodeErr *charset.DecodeError
+	for _, format := range []string{formatJSON, formatNDJSON} {
+		input := "{\"id\": \"e0001\", \"login\": \"zoe\", \"name\": \"Zo\xEB\", \"salary\": 1}"
+		if format == formatJSON {
+			input = "[" + input + "]"
+		}
+		reader, err := newJSONRecordReader(strings.NewReader(input), domains.UploadOptions{Format: format, Charset: charset.UTF8})
+		if err == nil {
+			_, _, err = readEmployeeRows(reader, DefaultColumnAliases, 100)
+		}
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("reading %v that is not UTF-8 as UTF-8 returned error %v, want a *charset.DecodeError", format, err)
+		}
+	}
+}
+
+func utf16LE(s string) string {
+	var b []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(unit), byte(unit>>8))
+	}
+	return string(b)
+}
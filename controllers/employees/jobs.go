@@ -0,0 +1,391 @@
+package employees
+
+import (
+	"awesomeProject/domains"
+	"awesomeProject/utils/db"
+	"awesomeProject/utils/xlsx"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+// jobPollInterval is how often the upload worker checks for queued jobs when it has not been
+// notified of a new one, e.g. for jobs requeued after a restart.
+const jobPollInterval = 10 * time.Second
+
+// StartUploadWorker starts the single worker that processes upload jobs one at a time, in the
+// order they were queued. Jobs left running by a previous process are queued again.
+func (h *employeeHandler) StartUploadWorker() error {
+	if err := os.MkdirAll(h.uploadConfig.SpoolDir, 0700); err != nil {
+		return err
+	}
+	if err := h.uploadJobsDAO.RequeueRunning(boil.GetDB()); err != nil {
+		return err
+	}
+	if err := h.uploadsDAO.MarkInterrupted(boil.GetDB()); err != nil {
+		return err
+	}
+	go h.runUploadWorker()
+	return nil
+}
+
+func (h *employeeHandler) notifyUploadWorker() {
+	select {
+	case h.jobQueued <- struct{}{}:
+	default:
+		// the worker has already been notified
+	}
+}
+
+func (h *employeeHandler) runUploadWorker() {
+	for {
+		// the client of a streamed upload is waiting on it, so it goes before queued jobs
+		select {
+		case stream := <-h.streams:
+			h.runStreamedJob(stream)
+			continue
+		default:
+		}
+		job, err := h.uploadJobsDAO.GetNextQueued(boil.GetDB())
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Error().Err(err).Msg("Failed to fetch the next upload job")
+			}
+			select {
+			case <-h.jobQueued:
+			case stream := <-h.streams:
+				h.runStreamedJob(stream)
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+		h.runUploadJob(job)
+	}
+}
+
+func (h *employeeHandler) runUploadJob(job *domains.UploadJob) {
+	startedAt := time.Now().UTC()
+	job.State = domains.UploadJobRunning
+	job.StartedAt = &startedAt
+	if err := h.uploadJobsDAO.UpdateUploadJob(boil.GetDB(), *job); err != nil {
+		h.failUploadJob(job, err)
+		return
+	}
+	h.processUploadFiles(job)
+}
+
+// processUploadFiles processes the files of a running job that have not been processed yet, and
+// then finishes the job.
+func (h *employeeHandler) processUploadFiles(job *domains.UploadJob) {
+	for i := range job.Files {
+		file := &job.Files[i]
+		if file.Processed {
+			// already committed before a restart
+			continue
+		}
+		h.processUploadFile(job, i, nil)
+		markProcessed(file)
+		if err := h.saveUploadFile(job, i); err != nil {
+			h.failUploadJob(job, err)
+			return
+		}
+	}
+
+	job.RowsProcessed, job.RowsFailed = 0, 0
+	failed, partial := 0, 0
+	for _, file := range job.Files {
+		job.RowsProcessed += file.Inserted + file.Updated + file.Unchanged + file.Skipped
+		job.RowsFailed += len(file.Errors)
+		if file.Error != "" {
+			failed++
+		} else if file.Rejected > 0 {
+			partial++
+		}
+	}
+	switch {
+	case failed == 0 && partial == 0:
+		job.State = domains.UploadJobSucceeded
+	case failed == len(job.Files):
+		job.State = domains.UploadJobFailed
+	default:
+		job.State = domains.UploadJobPartial
+	}
+	finishedAt := time.Now().UTC()
+	job.FinishedAt = &finishedAt
+	if err := h.uploadJobsDAO.UpdateUploadJob(boil.GetDB(), *job); err != nil {
+		h.failUploadJob(job, err)
+		return
+	}
+
+	h.removeSpooledFiles(job.ID, len(job.Files))
+}
+
+// markProcessed sets the status of a file from its result.
+func markProcessed(file *domains.UploadFile) {
+	file.Processed = true
+	switch {
+	case file.Error != "":
+		file.Status = domains.UploadFileFailed
+	case file.DuplicateOf != 0:
+		file.Status = domains.UploadFileDuplicate
+	case file.Rejected > 0:
+		file.Status = domains.UploadFilePartial
+	default:
+		file.Status = domains.UploadFileSucceeded
+	}
+}
+
+// saveUploadFile saves the result of a processed file along with the progress of its job.
+func (h *employeeHandler) saveUploadFile(job *domains.UploadJob, i int) error {
+	return db.WithTxn(func(txn boil.Transactor) error {
+		if err := h.uploadJobsDAO.SaveFileDetails(txn, job.ID, i, job.Files[i]); err != nil {
+			return err
+		}
+		return h.uploadJobsDAO.UpdateUploadJob(txn, *job)
+	})
+}
+
+// failUploadJob fails a job whose progress could not be saved, rather than leaving it running
+// while the worker moves on. If that cannot be saved either, e.g. while the database is down, the
+// job is left as it was last saved, and queued again on the next restart if it was running.
+func (h *employeeHandler) failUploadJob(job *domains.UploadJob, err error) {
+	log.Error().Err(err).Str("jobID", job.ID).Msg("Failed to save upload job")
+	finishedAt := time.Now().UTC()
+	job.State = domains.UploadJobFailed
+	job.Error = fmt.Sprintf("Failed to save the job: %v", err)
+	job.FinishedAt = &finishedAt
+	if err := h.uploadJobsDAO.UpdateUploadJob(boil.GetDB(), *job); err != nil {
+		log.Error().Err(err).Str("jobID", job.ID).Msg("Failed to save upload job")
+		return
+	}
+	h.removeSpooledFiles(job.ID, len(job.Files))
+}
+
+// processUploadFile processes a single file of a job, spooled or else streamed, recording it in
+// the upload history under its filename, shortened to fit if need be, e.g. for a long path within
+// an archive.
+func (h *employeeHandler) processUploadFile(job *domains.UploadJob, i int, stream *uploadStream) {
+	file := &job.Files[i]
+	upload := domains.Upload{
+		JobID:       job.ID,
+		Filename:    truncate(file.Filename, maxFilenameLength),
+		ContentHash: file.ContentHash,
+		OptionsHash: optionsHash(job.Options),
+		Uploader:    job.Uploader,
+		UploaderIP:  job.UploaderIP,
+		DryRun:      job.Options.DryRun,
+		Outcome:     domains.UploadRunning,
+		StartedAt:   time.Now().UTC(),
+	}
+	uploadID, err := h.uploadsDAO.AddUpload(boil.GetDB(), upload)
+	if err != nil {
+		file.Error = fmt.Sprintf("Failed to record upload: %v", err)
+		return
+	}
+	upload.ID = uploadID
+	file.UploadID = uploadID
+
+	// a sync deletes whatever the file does not list, which depends on the employees at the time,
+	// so it is never skipped as a duplicate
+	if stream != nil {
+		h.processStreamedUpload(job, i, stream)
+	} else if job.Options.Force || job.Options.Mode == domains.UploadModeSync || !h.reuseOriginalResult(job, i) {
+		h.processSpooledUpload(job, i)
+	}
+
+	upload.ContentHash = file.ContentHash
+	switch {
+	case file.DuplicateOf != 0:
+		upload.Outcome = domains.UploadDuplicate
+		upload.DuplicateOf = file.DuplicateOf
+	case file.Error != "":
+		upload.Outcome = domains.UploadFailed
+	default:
+		upload.Outcome = domains.UploadSucceeded
+	}
+	if file.DuplicateOf == 0 {
+		upload.Inserted = file.Inserted
+		upload.Updated = file.Updated
+		upload.Unchanged = file.Unchanged
+		upload.Skipped = file.Skipped
+		upload.Deleted = file.Deleted
+		upload.Failed = len(file.Errors)
+		upload.Comments = file.Comments
+		upload.Error = file.Error
+	}
+	finishedAt := time.Now().UTC()
+	upload.FinishedAt = &finishedAt
+	if err := h.uploadsDAO.UpdateUpload(boil.GetDB(), upload); err != nil {
+		log.Error().Err(err).Int64("uploadID", upload.ID).Msg("Failed to record upload")
+	}
+}
+
+// reuseOriginalResult looks for an earlier file of the job, or else an applied upload processed
+// with the same options, with the same content as the file. If there is one, the file is not
+// processed again: its result is copied from the original and it reports which upload that was.
+func (h *employeeHandler) reuseOriginalResult(job *domains.UploadJob, i int) bool {
+	file := &job.Files[i]
+	// the files of a job share its options
+	for j := 0; j < i; j++ {
+		original := job.Files[j]
+		if original.ContentHash != file.ContentHash || original.DuplicateOf != 0 || original.Error != "" {
+			continue
+		}
+		file.DuplicateOf = original.UploadID
+		file.Inserted = original.Inserted
+		file.Updated = original.Updated
+		file.Unchanged = original.Unchanged
+		file.Skipped = original.Skipped
+		file.Comments = original.Comments
+		file.Diff = original.Diff
+		return true
+	}
+
+	original, err := h.uploadsDAO.GetAppliedByHash(boil.GetDB(), file.ContentHash, optionsHash(job.Options))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.Error().Err(err).Str("jobID", job.ID).Msg("Failed to look up earlier uploads")
+		return false
+	}
+	file.DuplicateOf = original.ID
+	file.Inserted = original.Inserted
+	file.Updated = original.Updated
+	file.Unchanged = original.Unchanged
+	file.Skipped = original.Skipped
+	file.Comments = original.Comments
+	return true
+}
+
+// optionsHash returns the hex encoded SHA-256 of the options that decide the result of processing
+// a file, as the same content read with another delimiter, sheet or charset, or applied with
+// another mode or policy, is not a duplicate. Options that are not set are hashed as their
+// defaults.
+func optionsHash(options domains.UploadOptions) string {
+	delimiter, _ := parseDelimiter(options.Delimiter)
+	mode := options.Mode
+	if mode == "" {
+		mode = domains.UploadModeAtomic
+	}
+	policy := options.Policy
+	if policy == "" {
+		policy = domains.PolicyUpsert
+	}
+	key := fmt.Sprintf("format=%q delimiter=%q sheet=%q charset=%q mode=%q policy=%q", options.Format, delimiter, options.Sheet, options.Charset, mode, policy)
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func (h *employeeHandler) processSpooledUpload(job *domains.UploadJob, i int) {
+	file := &job.Files[i]
+
+	spooled, err := os.Open(h.spoolPath(job.ID, i))
+	if err != nil {
+		file.Error = fmt.Sprintf("Uploaded file is no longer available: %v", err)
+		return
+	}
+	defer spooled.Close()
+
+	result, err := h.processSpooledFile(spooled, file.UploadID, job.Options)
+	setFileResult(job, i, result, err)
+}
+
+// setFileResult records the result of processing a file of a job, or the error it failed with.
+func setFileResult(job *domains.UploadJob, i int, result *domains.UploadResult, err error) {
+	file := &job.Files[i]
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		file.Errors = validationErr.Errors
+	}
+	if err != nil {
+		file.Error = err.Error()
+		return
+	}
+
+	file.Inserted = len(result.Diff.Inserted)
+	file.Updated = len(result.Diff.Updated)
+	file.Unchanged = len(result.Diff.Unchanged)
+	file.Skipped = len(result.Diff.Skipped)
+	file.Deleted = len(result.Diff.Deleted)
+	file.Comments = result.Comments
+	file.Errors = result.Errors
+	file.Rejected = result.Rejected
+	if result.Rejected > 0 && !job.Options.DryRun {
+		file.Rejects = fmt.Sprintf("/users/uploads/%v/rejects", file.UploadID)
+	}
+	if job.Options.DryRun {
+		file.Diff = result.Diff
+	}
+}
+
+// processSpooledFile processes JSON imports as such, and otherwise sniffs the content of the
+// file, processing zip archives that hold a workbook as xlsx and anything else as CSV.
+func (h *employeeHandler) processSpooledFile(spooled *os.File, uploadID int64, options domains.UploadOptions) (*domains.UploadResult, error) {
+	info, err := spooled.Stat()
+	if err != nil {
+		return nil, err
+	}
+	switch options.Format {
+	case formatJSON, formatNDJSON:
+		return h.ProcessJSON(spooled, uploadID, options, nil)
+	}
+
+	header := make([]byte, 4)
+	n, _ := spooled.ReadAt(header, 0)
+
+	if xlsx.IsZip(header[:n]) {
+		if !xlsx.IsWorkbook(spooled, info.Size()) {
+			return nil, errors.New("Unsupported file format: zip archives must be xlsx workbooks")
+		}
+		return h.ProcessXLSX(spooled, info.Size(), uploadID, options)
+	}
+	return h.ProcessCSV(spooled, uploadID, options, nil)
+}
+
+func (h *employeeHandler) spoolPath(jobID string, i int) string {
+	return filepath.Join(h.uploadConfig.SpoolDir, fmt.Sprintf("%v-%v", jobID, i))
+}
+
+// spool copies src to path as it is read, returning the hex encoded SHA-256 of its content. If
+// inspect is not nil, it reads the content on its way to the file, e.g. to enforce limits while
+// the upload is still arriving.
+func spool(src io.Reader, path string, inspect func(io.Reader) error) (string, error) {
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	tee := io.TeeReader(src, io.MultiWriter(dst, hash))
+	if inspect != nil {
+		if err := inspect(tee); err != nil {
+			dst.Close()
+			return "", err
+		}
+	}
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		dst.Close()
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (h *employeeHandler) removeSpooledFiles(jobID string, count int) {
+	for i := 0; i < count; i++ {
+		if err := os.Remove(h.spoolPath(jobID, i)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Str("jobID", jobID).Msg("Failed to remove spooled upload")
+		}
+	}
+}
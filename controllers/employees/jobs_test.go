@@ -0,0 +1,43 @@
+package employees
+
+import (
+	"awesomeProject/domains"
+	"testing"
+)
+
+func TestOptionsHash(t *testing.T) {
+	defaults := optionsHash(domains.UploadOptions{})
+	same := []domains.UploadOptions{
+		{Delimiter: ",", Mode: domains.UploadModeAtomic, Policy: domains.PolicyUpsert},
+		{DryRun: true},
+		{Force: true},
+	}
+	for _, options := range same {
+		if optionsHash(options) != defaults {
+			t.Errorf("optionsHash(%+v) differs from the hash of the default options", options)
+		}
+	}
+	if optionsHash(domains.UploadOptions{Delimiter: "tab"}) != optionsHash(domains.UploadOptions{Delimiter: "\t"}) {
+		t.Error("optionsHash() differs for two names of the same delimiter")
+	}
+
+	different := []domains.UploadOptions{
+		{Format: formatNDJSON},
+		{Delimiter: ";"},
+		{Sheet: "Salaries"},
+		{Charset: "windows-1252"},
+		{Mode: domains.UploadModePartial},
+		{Policy: domains.PolicyInsertOnly},
+	}
+	seen := map[string]domains.UploadOptions{}
+	for _, options := range different {
+		hash := optionsHash(options)
+		if hash == defaults {
+			t.Errorf("optionsHash(%+v) is the hash of the default options", options)
+		}
+		if other, ok := seen[hash]; ok {
+			t.Errorf("optionsHash(%+v) is the hash of %+v", options, other)
+		}
+		seen[hash] = options
+	}
+}
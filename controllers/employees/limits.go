@@ -0,0 +1,92 @@
+package employees
+
+import (
+	"awesomeProject/utils/charset"
+	"awesomeProject/utils/csvreader"
+	"awesomeProject/utils/xlsx"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// limitError is returned when an upload exceeds one of the limits of the UploadConfig.
+type limitError struct {
+	message string
+}
+
+func (e *limitError) Error() string {
+	return e.message
+}
+
+func fileTooLargeError(maxFileSize int64) error {
+	return &limitError{fmt.Sprintf("File too large: files may be at most %v bytes", maxFileSize)}
+}
+
+func tooManyRowsError(maxRows int) error {
+	return &limitError{fmt.Sprintf("Too many rows: files may have at most %v employee rows", maxRows)}
+}
+
+// limitedReader fails with a limitError once more than limit bytes have been read, unlike
+// io.LimitReader which silently truncates.
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n, fileTooLargeError(l.limit)
+	}
+	return n, err
+}
+
+// countRows parses a file as it arrives to check it has at most maxRows employee rows, not
+// counting a header row. Workbooks cannot be read until they are complete, so their rows are only
+// counted when they are processed, and the rows of archives are counted as they are expanded.
+// Counting stops at text that is not valid in the encoding of the file, named by charsetName or
+// detected, which is left to fail that file when it is processed rather than the whole upload.
+func countRows(r io.Reader, charsetName string, aliases map[string]string, maxRows int) error {
+	buffered := bufio.NewReader(r)
+	header, _ := buffered.Peek(4)
+	if xlsx.IsZip(header) || isGzip(header) {
+		return nil
+	}
+
+	text, err := charset.NewReader(buffered, charsetName)
+	if err != nil {
+		return err
+	}
+	reader := csvreader.NewReader(text)
+	rows := 0
+	first := true
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var decodeErr *charset.DecodeError
+		if errors.As(err, &decodeErr) {
+			return nil
+		}
+		var parseErr *csvreader.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return err
+		}
+		if first {
+			first = false
+			if err == nil {
+				if _, isHeader, _ := detectHeader(record.Fields, aliases); isHeader {
+					continue
+				}
+			}
+		}
+		rows++
+		if rows > maxRows {
+			return tooManyRowsError(maxRows)
+		}
+	}
+}
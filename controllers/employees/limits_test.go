@@ -0,0 +1,72 @@
+package employees
+
+import (
+	"awesomeProject/utils/charset"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCountRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		charset string
+		maxRows int
+		wantErr error
+	}{
+		{
+			name:    "header is not counted",
+			input:   "id,login,name,salary\ne0001,hpotter,Harry Potter,1234.00\ne0002,rwesley,Ron Weasley,19234.50\n",
+			maxRows: 2,
+		},
+		{
+			name:    "too many rows",
+			input:   "e0001,hpotter,Harry Potter,1234.00\ne0002,rwesley,Ron Weasley,19234.50\n",
+			maxRows: 1,
+			wantErr: tooManyRowsError(1),
+		},
+		{
+			name:    "broken quotes count as rows",
+			input:   "e0001,hpotter,\"Harry\" Potter,1234.00\ne0002,rwesley,Ron Weasley,19234.50\n",
+			maxRows: 1,
+			wantErr: tooManyRowsError(1),
+		},
+		{
+			name:    "header after a broken first record is counted",
+			input:   "e0001,hpotter,\"Harry\" Potter,1234.00\nid,login,name,salary\n",
+			maxRows: 1,
+			wantErr: tooManyRowsError(1),
+		},
+		{
+			name:    "invalid encoding is left to the worker",
+			input:   "e0001,hpotter,Harry Potter,1234.00\ne0002,rwesley,Ron \xffWeasley,19234.50\ne0003,hgranger,Hermione Granger,1.00\n",
+			charset: charset.UTF8,
+			maxRows: 1,
+		},
+		{
+			name:    "workbooks are counted when they are processed",
+			input:   "PK\x03\x04",
+			maxRows: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := countRows(strings.NewReader(test.input), test.charset, DefaultColumnAliases, test.maxRows)
+			if test.wantErr == nil && err != nil {
+				t.Errorf("countRows() returned error %v", err)
+			}
+			if test.wantErr != nil && (err == nil || err.Error() != test.wantErr.Error()) {
+				t.Errorf("countRows() returned error %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCountRowsReadError(t *testing.T) {
+	src := &limitedReader{r: strings.NewReader(strings.Repeat("e0001,hpotter,Harry Potter,1234.00\n", 100)), limit: 64}
+	var limitErr *limitError
+	if err := countRows(src, "", DefaultColumnAliases, 1000); !errors.As(err, &limitErr) {
+		t.Errorf("countRows() returned error %v, want a *limitError", err)
+	}
+}
@@ -0,0 +1,60 @@
+package employees
+
+import (
+	"awesomeProject/domains"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sortableColumns are the columns employees can be sorted by.
+var sortableColumns = map[string]bool{"id": true, "name": true, "login": true, "salary": true}
+
+// parseSort reads a comma separated list of columns to sort by, each preceded by + (ascending) or
+// - (descending), e.g. -salary,+name. Later columns order the employees that sort the same on the
+// earlier ones.
+func parseSort(sortString string) ([]domains.SortKey, error) {
+	var keys []domains.SortKey
+	seen := make(map[string]bool)
+	for i, field := range strings.Split(sortString, ",") {
+		position := i + 1
+		if field == "" {
+			return nil, errors.New(fmt.Sprintf("Invalid data format: sort key %v is empty", position))
+		}
+		var key domains.SortKey
+		switch field[0] {
+		case '+':
+		case '-':
+			key.Desc = true
+		default:
+			return nil, errors.New(fmt.Sprintf("Invalid data format: sort key %v (%q) should start with %%2B (+) (ascending) or - (descending)", position, field))
+		}
+		key.Column = field[1:]
+		if !sortableColumns[key.Column] {
+			return nil, errors.New(fmt.Sprintf("Invalid data format: sort key %v (%q) is not a column, only columns \"id\", \"name\", \"login\" or \"salary\" can be sorted", position, key.Column))
+		}
+		if seen[key.Column] {
+			return nil, errors.New(fmt.Sprintf("Invalid data format: sort key %v (%q) repeats a column, each column can only be sorted once", position, key.Column))
+		}
+		seen[key.Column] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// formatSort writes keys the way parseSort reads them, or +id for no keys as employees are then
+// sorted by ID.
+func formatSort(keys []domains.SortKey) string {
+	if len(keys) == 0 {
+		return "+id"
+	}
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		if key.Desc {
+			fields[i] = "-" + key.Column
+		} else {
+			fields[i] = "+" + key.Column
+		}
+	}
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,63 @@
+package employees
+
+import (
+	"awesomeProject/domains"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		sort string
+		want []domains.SortKey
+	}{
+		{"+id", []domains.SortKey{{Column: "id"}}},
+		{"-salary", []domains.SortKey{{Column: "salary", Desc: true}}},
+		{"-salary,+name", []domains.SortKey{{Column: "salary", Desc: true}, {Column: "name"}}},
+		{"+login,-id,+name", []domains.SortKey{{Column: "login"}, {Column: "id", Desc: true}, {Column: "name"}}},
+	}
+	for _, test := range tests {
+		got, err := parseSort(test.sort)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseSort(%q) = %v, %v, want %v", test.sort, got, err, test.want)
+		}
+	}
+}
+
+func TestParseSortInvalid(t *testing.T) {
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"", "sort key 1 is empty"},
+		{"+name,", "sort key 2 is empty"},
+		{"name", `sort key 1 ("name") should start with`},
+		{" salary", `sort key 1 (" salary") should start with`},
+		{"+name,+password", `sort key 2 ("password") is not a column`},
+		{"+rank", `sort key 1 ("rank") is not a column`},
+		{"+Name", `sort key 1 ("Name") is not a column`},
+		{"+name,-salary,-name", `sort key 3 ("name") repeats a column`},
+	}
+	for _, test := range tests {
+		_, err := parseSort(test.sort)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("parseSort(%q) returned error %v, want one containing %q", test.sort, err, test.want)
+		}
+	}
+}
+
+func TestFormatSort(t *testing.T) {
+	if got := formatSort(nil); got != "+id" {
+		t.Errorf("formatSort(nil) = %q, want %q", got, "+id")
+	}
+	for _, sort := range []string{"+id", "-salary", "-salary,+name", "+login,-id,+name"} {
+		keys, err := parseSort(sort)
+		if err != nil {
+			t.Fatalf("parseSort(%q) returned error %v", sort, err)
+		}
+		if got := formatSort(keys); got != sort {
+			t.Errorf("formatSort(parseSort(%q)) = %q", sort, got)
+		}
+	}
+}
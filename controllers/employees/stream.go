@@ -0,0 +1,212 @@
+package employees
+
+import (
+	"awesomeProject/domains"
+	"awesomeProject/utils/xlsx"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+// errDuplicate rolls back a streamed file whose content turns out to have been applied already.
+var errDuplicate = errors.New("Duplicate upload")
+
+// uploadStream is a file handed from its request to the upload worker as it is received, so its
+// rows are written while it arrives rather than once it has been spooled. The worker keeps the
+// file in its transaction until the request accepts or rejects the rest of the upload, so a
+// rejected upload changes nothing.
+type uploadStream struct {
+	job     *domains.UploadJob // owned by the worker, listing only the streamed file
+	src     io.Reader
+	hash    hash.Hash
+	readErr error // of the request body, which fails the upload rather than the file
+
+	read    chan error // sent by the worker once the file has been read, failing the upload if not nil
+	verdict chan streamVerdict
+	done    chan domains.UploadJob // the job, once the accepted file has been committed
+
+	// worker side
+	finished bool
+	rejected error
+	files    []domains.UploadFile
+
+	// request side
+	decided bool
+}
+
+// streamVerdict accepts an upload along with the files spooled after the streamed one, or rejects it.
+type streamVerdict struct {
+	err   error
+	files []domains.UploadFile
+}
+
+func (s *uploadStream) Read(p []byte) (int, error) {
+	n, err := s.src.Read(p)
+	s.hash.Write(p[:n])
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.readErr = err
+	}
+	return n, err
+}
+
+// contentHash returns the hex encoded SHA-256 of the file, once it has been read.
+func (s *uploadStream) contentHash() string {
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// finishRead reads whatever is left of the file, e.g. after a file that failed, and waits for the
+// request to accept or reject the upload, returning the error it was rejected with. An error
+// fails the upload even if the file was read without one.
+func (s *uploadStream) finishRead(err error) error {
+	if s.finished {
+		return s.rejected
+	}
+	s.finished = true
+	if err == nil {
+		io.Copy(io.Discard, s)
+		err = s.readErr
+	}
+	s.read <- err
+	verdict := <-s.verdict
+	s.rejected, s.files = verdict.err, verdict.files
+	return s.rejected
+}
+
+// reject rolls back the streamed file. It does nothing once the upload has been accepted or
+// rejected.
+func (s *uploadStream) reject(err error) {
+	if s.decided {
+		return
+	}
+	s.decided = true
+	s.verdict <- streamVerdict{err: err}
+}
+
+// accept commits the streamed file, adding files to the job, and returns the job once the file has
+// been committed.
+func (s *uploadStream) accept(files []domains.UploadFile) domains.UploadJob {
+	s.decided = true
+	s.verdict <- streamVerdict{files: files}
+	return <-s.done
+}
+
+// streamPart streams an uploaded file to the upload worker, adding a placeholder for it to the job.
+// Workbooks and archives cannot be read until they are complete, so they are spooled instead and
+// no stream is returned.
+func (h *employeeHandler) streamPart(c *gin.Context, src io.Reader, filename string, job *domains.UploadJob) (*uploadStream, error) {
+	buffered := bufio.NewReader(src)
+	header, _ := buffered.Peek(4)
+	if xlsx.IsZip(header) || isGzip(header) {
+		return nil, h.spoolPart(buffered, filename, job)
+	}
+	job.Files = append(job.Files, domains.UploadFile{Filename: filename})
+	return h.startStream(c, *job, filename, buffered)
+}
+
+// startStream hands a file to the upload worker as the only file of a copy of the job, and
+// returns once the worker has read all of it. If an error is returned along with the stream, the
+// upload has failed, e.g. with a file over the size limit, and the stream must be rejected.
+func (h *employeeHandler) startStream(c *gin.Context, job domains.UploadJob, filename string, src io.Reader) (*uploadStream, error) {
+	job.Files = []domains.UploadFile{{Filename: filename, Status: domains.UploadFilePending}}
+	stream := &uploadStream{
+		job:     &job,
+		src:     src,
+		hash:    sha256.New(),
+		read:    make(chan error),
+		verdict: make(chan streamVerdict),
+		done:    make(chan domains.UploadJob, 1),
+	}
+	select {
+	case h.streams <- stream:
+	case <-c.Request.Context().Done():
+		// the client left while the worker was busy
+		return nil, c.Request.Context().Err()
+	}
+	return stream, <-stream.read
+}
+
+// runStreamedJob runs a job whose first file is streamed from its request. The job is saved as
+// running once the worker takes it, and the files spooled after the streamed one are processed
+// like those of a queued job, once the client has been answered.
+func (h *employeeHandler) runStreamedJob(stream *uploadStream) {
+	job := stream.job
+	startedAt := time.Now().UTC()
+	job.State = domains.UploadJobRunning
+	job.StartedAt = &startedAt
+	if err := h.uploadJobsDAO.AddUploadJob(boil.GetDB(), *job); err != nil {
+		stream.finishRead(&internalError{err})
+		return
+	}
+
+	h.processUploadFile(job, 0, stream)
+	if !stream.finished {
+		// the file failed before it could be read, e.g. as it could not be recorded
+		stream.finishRead(&internalError{errors.New(job.Files[0].Error)})
+	}
+	markProcessed(&job.Files[0])
+	for _, file := range stream.files {
+		file.Status = domains.UploadFilePending
+		job.Files = append(job.Files, file)
+	}
+	err := h.saveUploadFile(job, 0)
+	if err != nil {
+		h.failUploadJob(job, err)
+	}
+	answered := *job
+	answered.Files = append([]domains.UploadFile(nil), job.Files...)
+	stream.done <- answered
+	if err == nil {
+		h.processUploadFiles(job)
+	}
+}
+
+// processStreamedUpload processes a file while it is being received. Its content hash is only
+// known once it has been read, so a file found to duplicate an earlier upload is rolled back
+// rather than skipped, and its result copied from the original.
+func (h *employeeHandler) processStreamedUpload(job *domains.UploadJob, i int, stream *uploadStream) {
+	file := &job.Files[i]
+	duplicate := false
+	beforeCommit := func() error {
+		if err := stream.finishRead(nil); err != nil {
+			return err
+		}
+		file.ContentHash = stream.contentHash()
+		if !job.Options.Force && job.Options.Mode != domains.UploadModeSync && h.reuseOriginalResult(job, i) {
+			duplicate = true
+			return errDuplicate
+		}
+		return nil
+	}
+
+	var result *domains.UploadResult
+	var err error
+	switch job.Options.Format {
+	case formatJSON, formatNDJSON:
+		result, err = h.ProcessJSON(stream, file.UploadID, job.Options, beforeCommit)
+	default:
+		result, err = h.ProcessCSV(stream, file.UploadID, job.Options, beforeCommit)
+	}
+	if duplicate {
+		return
+	}
+	if !stream.finished {
+		// the file failed before its end, which only fails the whole upload over a limit
+		var limitErr *limitError
+		var uploadErr error
+		if errors.As(err, &limitErr) {
+			uploadErr = err
+		}
+		if rejected := stream.finishRead(uploadErr); rejected != nil {
+			err = rejected
+		}
+		file.ContentHash = stream.contentHash()
+	}
+	setFileResult(job, i, result, err)
+}
@@ -0,0 +1,70 @@
+package employees
+
+import (
+	"awesomeProject/domains"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUploadStream(t *testing.T) {
+	content := "id,login,name,salary\ne0001,hpotter,Harry Potter,1234.00\ne0002,rwesley,Ron Weasley,19234.50\n"
+	sum := sha256.Sum256([]byte(content))
+	tests := []struct {
+		name      string
+		maxSize   int64
+		readBytes int   // read by the worker before it finishes the file
+		verdict   error // nil to accept
+		wantRead  bool  // the request is told the read failed
+	}{
+		{name: "read to the end", maxSize: 1 << 20, readBytes: len(content)},
+		{name: "failed before the end", maxSize: 1 << 20, readBytes: 10},
+		{name: "rejected", maxSize: 1 << 20, readBytes: len(content), verdict: errors.New("Too many files")},
+		{name: "too large", maxSize: 20, readBytes: 10, verdict: fileTooLargeError(20), wantRead: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream := &uploadStream{
+				job:     &domains.UploadJob{Files: []domains.UploadFile{{Filename: "employees.csv"}}},
+				src:     &limitedReader{r: strings.NewReader(content), limit: test.maxSize},
+				hash:    sha256.New(),
+				read:    make(chan error),
+				verdict: make(chan streamVerdict),
+				done:    make(chan domains.UploadJob, 1),
+			}
+			rejected := make(chan error)
+			go func() {
+				io.ReadFull(stream, make([]byte, test.readBytes))
+				rejected <- stream.finishRead(nil)
+			}()
+
+			readErr := <-stream.read
+			var limitErr *limitError
+			if test.wantRead != errors.As(readErr, &limitErr) {
+				t.Errorf("the request was told the file was read with error %v", readErr)
+			}
+			if test.verdict != nil {
+				stream.reject(test.verdict)
+			} else {
+				stream.decided = true
+				stream.verdict <- streamVerdict{files: []domains.UploadFile{{Filename: "more.csv"}}}
+			}
+			if err := <-rejected; err != test.verdict {
+				t.Errorf("finishRead() = %v, want %v", err, test.verdict)
+			}
+			if test.verdict == nil && (len(stream.files) != 1 || stream.files[0].Filename != "more.csv") {
+				t.Errorf("the worker was handed files %v, want more.csv", stream.files)
+			}
+			// finishing again returns the verdict without waiting for another
+			if err := stream.finishRead(nil); err != test.verdict {
+				t.Errorf("finishRead() = %v the second time, want %v", err, test.verdict)
+			}
+			if !test.wantRead && stream.contentHash() != hex.EncodeToString(sum[:]) {
+				t.Errorf("contentHash() = %v, want the hash of the whole file", stream.contentHash())
+			}
+		})
+	}
+}
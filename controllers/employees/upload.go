@@ -0,0 +1,1082 @@
+package employees
+
+import (
+	"awesomeProject/daos"
+	"awesomeProject/domains"
+	"awesomeProject/models"
+	"awesomeProject/utils/charset"
+	"awesomeProject/utils/csvreader"
+	"awesomeProject/utils/db"
+	"awesomeProject/utils/xlsx"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+// column sizes from resources/schema.sql
+const (
+	maxIDLength    = 16
+	maxLoginLength = 128
+	maxNameLength  = 128
+
+	maxUploaderLength = 128
+	maxFilenameLength = 255
+)
+
+// ValidationError is returned when one or more rows of an uploaded file are invalid. Nothing
+// from the file is kept when it is returned.
+type ValidationError struct {
+	Errors []domains.RowError
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Invalid employee rows: %v row(s) failed validation", len(e.Errors))
+}
+
+// SyncThresholdError is returned when a sync upload would delete a larger share of the employees
+// than allowed. Nothing from the file is written when it is returned.
+type SyncThresholdError struct {
+	Deleted    int
+	Existing   int
+	MaxPercent float64
+}
+
+func (e *SyncThresholdError) Error() string {
+	return fmt.Sprintf("Sync aborted: %v of %v employees (%.1f%%) would be deleted, more than the maximum of %v%%",
+		e.Deleted, e.Existing, float64(e.Deleted)*100/float64(e.Existing), e.MaxPercent)
+}
+
+// employeeRow is a validated employee along with the line it was read from.
+type employeeRow struct {
+	Line     int
+	Raw      string
+	Employee models.Employee
+}
+
+func (h *employeeHandler) uploadCSV(c *gin.Context) {
+	options, err := parseUploadOptions(c)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+
+	// parts are read as they arrive rather than buffered by c.MultipartForm, so each file is
+	// written once, to the spool, and the limits are enforced while it is being received
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.Error(errors.New(fmt.Sprintf("Invalid upload: the request should be multipart/form-data: %v", err)))
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+
+	uploader, uploaderIP := h.uploaderIdentity(c)
+	job, err := newUploadJob(options, uploader, uploaderIP)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, c.Errors.Last())
+		return
+	}
+	// an archive counts as a single file, its entries being limited by MaxArchiveEntries instead
+	files := 0
+	var stream *uploadStream
+	defer func() {
+		// the worker holds the streamed file open until the upload is accepted or rejected
+		if stream != nil {
+			stream.reject(errors.New("Upload aborted"))
+		}
+	}()
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			err = errors.New(fmt.Sprintf("Invalid upload: %v", err))
+			h.abortUpload(job, stream, err)
+			c.Error(err)
+			c.JSON(http.StatusBadRequest, c.Errors.Last())
+			return
+		}
+		src := &limitedReader{r: part, limit: h.uploadConfig.MaxFileSize}
+		if part.FormName() != "file" {
+			// other form fields are not used, but still count towards the limits
+			_, err = io.Copy(io.Discard, src)
+		} else if files >= h.uploadConfig.MaxFiles {
+			err = errors.New(fmt.Sprintf("Too many files: at most %v files can be uploaded at once", h.uploadConfig.MaxFiles))
+		} else if files == 0 {
+			files++
+			stream, err = h.streamPart(c, src, part.FileName(), &job)
+		} else {
+			files++
+			err = h.spoolPart(src, part.FileName(), &job)
+		}
+		part.Close()
+		if err != nil {
+			h.abortUpload(job, stream, err)
+			c.Error(err)
+			c.JSON(uploadErrorStatus(err), c.Errors.Last())
+			return
+		}
+	}
+	if len(job.Files) == 0 {
+		c.Error(errors.New("No files were uploaded: at least one \"file\" part is required"))
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+	if options.Mode == domains.UploadModeSync && len(job.Files) > 1 {
+		// every file would delete the employees listed by the others
+		err := errors.New(fmt.Sprintf("Invalid upload: mode=sync takes a single file with every employee, got %v files", len(job.Files)))
+		h.abortUpload(job, stream, err)
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+
+	if stream == nil {
+		h.queueUploadJob(c, job)
+		return
+	}
+	c.JSON(http.StatusAccepted, stream.accept(job.Files[1:]))
+}
+
+// abortUpload removes the files spooled for an upload that was rejected, and rolls back its
+// streamed file, if any.
+func (h *employeeHandler) abortUpload(job domains.UploadJob, stream *uploadStream, err error) {
+	// including a file that was being spooled
+	h.removeSpooledFiles(job.ID, len(job.Files)+1)
+	if stream != nil {
+		stream.reject(err)
+	}
+}
+
+// spoolPart spools an uploaded file and adds it to the job, counting its rows as it arrives.
+// Archives are replaced by the files they contain.
+func (h *employeeHandler) spoolPart(src io.Reader, filename string, job *domains.UploadJob) error {
+	path := h.spoolPath(job.ID, len(job.Files))
+	contentHash, err := spool(src, path, func(r io.Reader) error {
+		return countRows(r, job.Options.Charset, h.uploadConfig.ColumnAliases, h.uploadConfig.MaxRows)
+	})
+	if err != nil {
+		return err
+	}
+	if archive, err := h.expandArchive(job, path, filename); archive || err != nil {
+		return err
+	}
+	job.Files = append(job.Files, domains.UploadFile{Filename: filename, ContentHash: contentHash})
+	return nil
+}
+
+// internalError is returned for uploads that fail on the side of the service, e.g. when their job
+// cannot be saved.
+type internalError struct {
+	err error
+}
+
+func (e *internalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *internalError) Unwrap() error {
+	return e.err
+}
+
+// uploadErrorStatus is 413 for uploads that exceed a limit, 500 for uploads the service failed,
+// and 400 for other invalid uploads.
+func uploadErrorStatus(err error) int {
+	var limitErr *limitError
+	if errors.As(err, &limitErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	var internalErr *internalError
+	if errors.As(err, &internalErr) {
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// encodingError explains how to fix text that is not valid in the encoding it was read as, and
+// returns other errors as they are.
+func encodingError(err error) error {
+	var decodeErr *charset.DecodeError
+	if errors.As(err, &decodeErr) {
+		return errors.New(fmt.Sprintf("Invalid character encoding: %v, use the charset parameter to name the encoding of the file", decodeErr))
+	}
+	return err
+}
+
+// parseUploadOptions reads the query parameters shared by every upload endpoint.
+func parseUploadOptions(c *gin.Context) (domains.UploadOptions, error) {
+	options := domains.UploadOptions{
+		Delimiter: c.Query("delimiter"),
+		Sheet:     c.Query("sheet"),
+	}
+	if _, err := parseDelimiter(options.Delimiter); err != nil {
+		return options, err
+	}
+	if charsetName := c.Query("charset"); charsetName != "" {
+		var ok bool
+		options.Charset, ok = charset.Lookup(charsetName)
+		if !ok {
+			return options, errors.New("Invalid data format: charset should be \"utf-8\", \"utf-16le\", \"utf-16be\" or \"windows-1252\"")
+		}
+	}
+
+	switch mode := c.Query("mode"); mode {
+	case "", domains.UploadModeAtomic:
+	case domains.UploadModePartial, domains.UploadModeSync:
+		options.Mode = mode
+	default:
+		return options, errors.New("Invalid data format: mode should be \"atomic\", \"partial\" or \"sync\"")
+	}
+
+	switch policy := c.Query("policy"); policy {
+	case "":
+		options.Policy = domains.PolicyUpsert
+	case domains.PolicyUpsert, domains.PolicyInsertOnly, domains.PolicyUpdateOnly, domains.PolicySkipExisting:
+		options.Policy = policy
+	default:
+		return options, errors.New("Invalid data format: policy should be \"upsert\", \"insertOnly\", \"updateOnly\" or \"skipExisting\"")
+	}
+	if options.Mode == domains.UploadModeSync && options.Policy != domains.PolicyUpsert {
+		return options, errors.New("Invalid data format: mode=sync upserts every row, so policy should be \"upsert\"")
+	}
+
+	maxDeleteString, present := c.GetQuery("maxDeletePercent")
+	if present && maxDeleteString != "" {
+		if options.Mode != domains.UploadModeSync {
+			return options, errors.New("Invalid data format: maxDeletePercent only applies to mode=sync")
+		}
+		maxDelete, err := strconv.ParseFloat(maxDeleteString, 64)
+		if err != nil || maxDelete < 0 || maxDelete > 100 {
+			return options, errors.New("Invalid data format: maxDeletePercent should be a number from 0 to 100")
+		}
+		options.MaxDeletePercent = &maxDelete
+	}
+
+	dryRunString, present := c.GetQuery("dryRun")
+	if present && dryRunString != "" {
+		var err error
+		options.DryRun, err = strconv.ParseBool(dryRunString)
+		if err != nil {
+			return options, errors.New("Invalid data format: dryRun should be true or false")
+		}
+	}
+
+	forceString, present := c.GetQuery("force")
+	if present && forceString != "" {
+		var err error
+		options.Force, err = strconv.ParseBool(forceString)
+		if err != nil {
+			return options, errors.New("Invalid data format: force should be true or false")
+		}
+	}
+	return options, nil
+}
+
+func newUploadJob(options domains.UploadOptions, uploader string, uploaderIP string) (domains.UploadJob, error) {
+	jobID, err := uuid.NewV4()
+	if err != nil {
+		return domains.UploadJob{}, err
+	}
+	return domains.UploadJob{
+		ID:         jobID.String(),
+		State:      domains.UploadJobQueued,
+		Uploader:   uploader,
+		UploaderIP: uploaderIP,
+		Options:    options,
+		CreatedAt:  time.Now().UTC(),
+	}, nil
+}
+
+// uploaderIdentity identifies who made an upload for the upload history, along with the client's
+// address: the X-Uploader header if the request was forwarded by a trusted proxy, which sets it to
+// the user it authenticated, or else the client's address. The header is ignored from any other
+// client, who could otherwise record any name.
+func (h *employeeHandler) uploaderIdentity(c *gin.Context) (string, string) {
+	clientIP := c.ClientIP()
+	identity := clientIP
+	if h.fromTrustedProxy(c) {
+		if uploader := strings.TrimSpace(c.GetHeader("X-Uploader")); uploader != "" {
+			identity = uploader
+		}
+	}
+	return truncate(identity, maxUploaderLength), clientIP
+}
+
+// fromTrustedProxy reports whether the request was sent by one of the trusted proxies.
+func (h *employeeHandler) fromTrustedProxy(c *gin.Context) bool {
+	remoteIP, _ := c.RemoteIP()
+	if remoteIP == nil {
+		return false
+	}
+	// validated when the configuration was loaded
+	proxies, _ := parseProxies(h.uploadConfig.TrustedProxies)
+	for _, proxy := range proxies {
+		if proxy.Contains(remoteIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate shortens s to at most maxLength characters, to fit a column of the upload history.
+func truncate(s string, maxLength int) string {
+	if utf8.RuneCountInString(s) > maxLength {
+		return string([]rune(s)[:maxLength])
+	}
+	return s
+}
+
+// queueUploadJob saves a job whose files have been spooled and responds with it.
+func (h *employeeHandler) queueUploadJob(c *gin.Context, job domains.UploadJob) {
+	if err := h.addUploadJob(&job); err != nil {
+		h.removeSpooledFiles(job.ID, len(job.Files))
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, c.Errors.Last())
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// addUploadJob saves a job whose files have been spooled and notifies the upload worker.
+func (h *employeeHandler) addUploadJob(job *domains.UploadJob) error {
+	for i := range job.Files {
+		job.Files[i].Status = domains.UploadFilePending
+	}
+	if err := h.uploadJobsDAO.AddUploadJob(boil.GetDB(), *job); err != nil {
+		return err
+	}
+	h.notifyUploadWorker()
+	return nil
+}
+
+func (h *employeeHandler) getUploadJob(c *gin.Context) {
+	jobID := c.Param("jobID")
+	job, err := h.uploadJobsDAO.GetByID(boil.GetDB(), jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.Error(errors.New(fmt.Sprintf("Upload job with ID %v does not exist", jobID)))
+		c.JSON(http.StatusNotFound, c.Errors.Last())
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// recordReader is a source of employee records, e.g. a CSV file or a worksheet.
+type recordReader interface {
+	Read() (*csvreader.Record, error)
+	// Comments returns the number of comment lines skipped so far.
+	Comments() int
+}
+
+// ProcessCSV writes the rows of the file in batches as they are read, within one transaction. If
+// any row is invalid, a *ValidationError listing them is returned and the file is rolled back,
+// unless the mode is partial: then the valid rows are applied and the rejected rows are saved as
+// a CSV file under uploadID. The diff of the result describes what the file changed, or would have changed for a
+// dry run. The prior state of every changed employee is snapshotted under uploadID, so the upload
+// can be reverted. In sync mode, the employees that the file does not list are deleted as well.
+// The file is transcoded to UTF-8 from the charset of the options, or else from the encoding
+// detected from its content. If beforeCommit is not nil, it is called once the file has been
+// applied, and the file is rolled back if it returns an error.
+func (h *employeeHandler) ProcessCSV(file io.Reader, uploadID int64, options domains.UploadOptions, beforeCommit func() error) (*domains.UploadResult, error) {
+	delimiter, err := parseDelimiter(options.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+	text, err := charset.NewReader(file, options.Charset)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csvreader.NewReader(text)
+	reader.Comma = delimiter
+	result, err := h.processRecords(reader, uploadID, options, beforeCommit)
+	if err != nil {
+		return nil, encodingError(err)
+	}
+	return result, nil
+}
+
+// ProcessXLSX processes a sheet of an xlsx workbook the same way ProcessCSV processes a file. The
+// parts of the workbook are held to the same expanded size and compression ratio as archives.
+func (h *employeeHandler) ProcessXLSX(file io.ReaderAt, size int64, uploadID int64, options domains.UploadOptions) (*domains.UploadResult, error) {
+	reader, err := xlsx.NewReader(file, size, options.Sheet, h.workbookGuard())
+	if errors.Is(err, xlsx.ErrSheetNotFound) {
+		return nil, errors.New(fmt.Sprintf("Invalid workbook: sheet %q does not exist", options.Sheet))
+	}
+	if errors.Is(err, xlsx.ErrPartTooLarge) {
+		return nil, &limitError{fmt.Sprintf("Workbook too large: the relationship and workbook parts may expand to at most %v bytes", xlsx.MaxMetadataSize)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return h.processRecords(&xlsxRecordReader{Reader: reader}, uploadID, options, nil)
+}
+
+// processRecords reads the rows of a file and writes them in batches of BatchSize as they are read,
+// all within one transaction, so a streamed file is written while it is still being received. Once
+// a row has failed, an atomic or sync upload writes nothing more but still reads the whole file, to
+// report every failing row, and is rolled back. If beforeCommit is not nil, it is called once the
+// whole file has been applied, and the file is rolled back if it returns an error.
+func (h *employeeHandler) processRecords(reader recordReader, uploadID int64, options domains.UploadOptions, beforeCommit func() error) (*domains.UploadResult, error) {
+	rows := newEmployeeRowReader(reader, h.uploadConfig.ColumnAliases, h.uploadConfig.MaxRows)
+	var writer *rowWriter
+	apply := func(txn boil.Transactor) error {
+		writer = h.newRowWriter(txn, uploadID, options, rows.file)
+		for {
+			row, err := rows.next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := writer.add(row); err != nil {
+				return err
+			}
+		}
+		if err := writer.flush(true); err != nil {
+			return err
+		}
+
+		file := rows.file
+		if len(file.errors) > 0 && options.Mode != domains.UploadModePartial {
+			return &ValidationError{Errors: file.errors}
+		}
+		if len(writer.listed) == 0 && len(file.errors) == 0 {
+			return errors.New(fmt.Sprintf("Employees Added is 0 : empty file was uploaded"))
+		}
+		if options.Mode == domains.UploadModeSync {
+			maxPercent := h.uploadConfig.MaxSyncDeletePercent
+			if options.MaxDeletePercent != nil {
+				maxPercent = *options.MaxDeletePercent
+			}
+			if err := h.deleteAbsentEmployees(txn, uploadID, writer.listed, writer.diff, maxPercent); err != nil {
+				return err
+			}
+		}
+		if len(file.errors) > 0 {
+			if err := h.uploadsDAO.AddRejects(txn, uploadID, file.rejectsCSV(reader)); err != nil {
+				return err
+			}
+		}
+		if beforeCommit != nil {
+			return beforeCommit()
+		}
+		return nil
+	}
+	var err error
+	if options.DryRun {
+		err = db.WithRollback(apply)
+	} else {
+		err = db.WithTxn(apply)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &domains.UploadResult{
+		Diff:     writer.diff,
+		Comments: reader.Comments(),
+		Errors:   rows.file.errors,
+		Rejected: len(rows.file.rejected),
+	}, nil
+}
+
+// rowWriter writes the rows of a file in batches as they are read. A row whose login is held by
+// an employee the file has not listed yet is carried over to the next batch, as a later row may
+// still rename that employee and release the login.
+type rowWriter struct {
+	h        *employeeHandler
+	txn      boil.Transactor
+	uploadID int64
+	options  domains.UploadOptions
+	file     *employeeFile
+	batch    []employeeRow // not written yet, starting with the rows carried over
+	carried  int
+	listed   map[string]bool // IDs of the valid rows read so far, by collation key
+	diff     *domains.EmployeeDiff
+}
+
+func (h *employeeHandler) newRowWriter(txn boil.Transactor, uploadID int64, options domains.UploadOptions, file *employeeFile) *rowWriter {
+	return &rowWriter{
+		h:        h,
+		txn:      txn,
+		uploadID: uploadID,
+		options:  options,
+		file:     file,
+		listed:   map[string]bool{},
+		diff: &domains.EmployeeDiff{
+			Inserted:  []string{},
+			Updated:   []domains.EmployeeChange{},
+			Unchanged: []string{},
+			Skipped:   []string{},
+			Deleted:   []string{},
+		},
+	}
+}
+
+// add adds a row to the batch, writing the batch once it holds BatchSize new rows.
+func (w *rowWriter) add(row employeeRow) error {
+	w.listed[daos.CollationKey(row.Employee.ID)] = true
+	w.batch = append(w.batch, row)
+	if len(w.batch)-w.carried < w.h.uploadConfig.BatchSize {
+		return nil
+	}
+	return w.flush(false)
+}
+
+// flush writes the batch. Rows in conflict are rejected, and in partial mode the rest of the batch
+// is written without them. Once the whole file has been read, no row is carried over any more.
+func (w *rowWriter) flush(final bool) error {
+	partial := w.options.Mode == domains.UploadModePartial
+	for len(w.batch) > 0 {
+		if len(w.file.errors) > 0 && !partial {
+			// the upload fails, so only the errors of the remaining rows matter
+			w.batch, w.carried = w.batch[:0], 0
+			return nil
+		}
+		pending := func(holderID string) bool {
+			return !final && !w.listed[daos.CollationKey(holderID)]
+		}
+		diff, carried, err := w.h.applyEmployeeRows(w.txn, w.uploadID, w.batch, w.options.Policy, pending)
+		var conflicts *ValidationError
+		if errors.As(err, &conflicts) {
+			// nothing of the batch has been written yet, so leave out the rows in conflict and try again
+			w.batch = w.file.reject(w.batch, conflicts.Errors)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		w.diff.Inserted = append(w.diff.Inserted, diff.Inserted...)
+		w.diff.Updated = append(w.diff.Updated, diff.Updated...)
+		w.diff.Unchanged = append(w.diff.Unchanged, diff.Unchanged...)
+		w.diff.Skipped = append(w.diff.Skipped, diff.Skipped...)
+		w.batch, w.carried = append(w.batch[:0], carried...), len(carried)
+		return nil
+	}
+	return nil
+}
+
+// employeeFile holds the header of a file, and the errors and original text of the rows that were
+// rejected.
+type employeeFile struct {
+	header   *csvreader.Record // nil if the file has no header row
+	errors   []domains.RowError
+	rejected map[int]string // original text of the rejected rows by line
+}
+
+// reject records the errors of rows, returning the rows that have none.
+func (f *employeeFile) reject(rows []employeeRow, rowErrors []domains.RowError) []employeeRow {
+	lines := make(map[int]bool, len(rowErrors))
+	for _, rowError := range rowErrors {
+		lines[rowError.Line] = true
+	}
+	valid := rows[:0]
+	for _, row := range rows {
+		if lines[row.Line] {
+			f.rejected[row.Line] = row.Raw
+		} else {
+			valid = append(valid, row)
+		}
+	}
+	f.errors = append(f.errors, rowErrors...)
+	sort.SliceStable(f.errors, func(i, j int) bool { return f.errors[i].Line < f.errors[j].Line })
+	return valid
+}
+
+// rejectsCSV lists the rejected rows as they appeared in the file, under the file's header, so they
+// can be fixed and uploaded again. The error is added as the first column, where it lines up even
+// for rows with missing fields or broken quotes.
+func (f *employeeFile) rejectsCSV(reader recordReader) string {
+	comma := ','
+	if csvReader, ok := reader.(*csvreader.Reader); ok {
+		comma = csvReader.Comma
+	}
+	reasons := make(map[int][]string, len(f.rejected))
+	for _, rowError := range f.errors {
+		reason := rowError.Reason
+		if rowError.Field != "" {
+			reason = rowError.Field + ": " + reason
+		}
+		reasons[rowError.Line] = append(reasons[rowError.Line], reason)
+	}
+	lines := make([]int, 0, len(f.rejected))
+	for line := range f.rejected {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	var b strings.Builder
+	b.WriteString("error")
+	b.WriteRune(comma)
+	if f.header != nil {
+		b.WriteString(f.header.Raw)
+	} else {
+		b.WriteString(csvreader.Join(employeeColumns, comma))
+	}
+	b.WriteByte('\n')
+	for _, line := range lines {
+		b.WriteString(csvreader.Quote(fmt.Sprintf("line %v: %v", line, strings.Join(reasons[line], "; ")), comma))
+		b.WriteRune(comma)
+		b.WriteString(f.rejected[line])
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// employeeRowReader parses and validates the records of a file one row at a time. If the first
+// record is a header row, columns are mapped by name instead of position. The rows it rejects are
+// recorded in its file.
+type employeeRowReader struct {
+	reader     recordReader
+	aliases    map[string]string
+	maxRows    int
+	mapping    columnMapping
+	first      bool
+	records    int
+	file       *employeeFile
+	idLines    map[string]int // line of the first row of each ID, by collation key
+	loginLines map[string]int // line of the first row of each login, by collation key
+}
+
+func newEmployeeRowReader(reader recordReader, aliases map[string]string, maxRows int) *employeeRowReader {
+	return &employeeRowReader{
+		reader:     reader,
+		aliases:    aliases,
+		maxRows:    maxRows,
+		mapping:    defaultColumnMapping(),
+		first:      true,
+		file:       &employeeFile{rejected: map[int]string{}},
+		idLines:    map[string]int{},
+		loginLines: map[string]int{},
+	}
+}
+
+// next returns the next valid row, or io.EOF once every record has been read. Files with more
+// than maxRows records are rejected without reading further.
+func (r *employeeRowReader) next() (employeeRow, error) {
+	for {
+		record, err := r.reader.Read()
+		if errors.Is(err, io.EOF) {
+			return employeeRow{}, io.EOF
+		}
+		// only the first record can be a header, so a header after a broken first record is a row
+		if r.first {
+			r.first = false
+			if err == nil {
+				headerMapping, isHeader, err := detectHeader(record.Fields, r.aliases)
+				if err != nil {
+					return employeeRow{}, err
+				}
+				if isHeader {
+					r.mapping = headerMapping
+					r.file.header = record
+					continue
+				}
+			}
+		}
+		r.records++
+		if r.records > r.maxRows {
+			return employeeRow{}, tooManyRowsError(r.maxRows)
+		}
+		var parseErr *csvreader.ParseError
+		if errors.As(err, &parseErr) {
+			r.file.errors = append(r.file.errors, domains.RowError{
+				Line:   parseErr.Line,
+				Reason: parseErr.Err.Error(),
+			})
+			r.file.rejected[parseErr.Line] = parseErr.Raw
+			continue
+		}
+		if err != nil {
+			return employeeRow{}, err
+		}
+
+		employee, errs := validateRecord(record, r.mapping)
+		row := employeeRow{Line: record.Line, Raw: record.Raw, Employee: employee}
+		if len(errs) == 0 {
+			errs = r.duplicateErrors(row)
+		}
+		if len(errs) > 0 {
+			r.file.errors = append(r.file.errors, errs...)
+			r.file.rejected[record.Line] = record.Raw
+			continue
+		}
+		return row, nil
+	}
+}
+
+// duplicateErrors reports a row that repeats the ID or login of an earlier row, as the order of
+// the rows would otherwise silently decide which one is kept.
+func (r *employeeRowReader) duplicateErrors(row employeeRow) []domains.RowError {
+	var errs []domains.RowError
+	idKey := daos.CollationKey(row.Employee.ID)
+	if line, duplicate := r.idLines[idKey]; duplicate {
+		errs = append(errs, domains.RowError{
+			Line:       row.Line,
+			EmployeeID: row.Employee.ID,
+			Field:      "id",
+			Reason:     fmt.Sprintf("Duplicate employee: id %v also appears on line %v", row.Employee.ID, line),
+		})
+	} else {
+		r.idLines[idKey] = row.Line
+	}
+
+	loginKey := daos.CollationKey(row.Employee.Login)
+	if line, duplicate := r.loginLines[loginKey]; duplicate {
+		errs = append(errs, domains.RowError{
+			Line:       row.Line,
+			EmployeeID: row.Employee.ID,
+			Field:      "login",
+			Reason:     fmt.Sprintf("Duplicate login: %v also appears on line %v", row.Employee.Login, line),
+		})
+	} else {
+		r.loginLines[loginKey] = row.Line
+	}
+	return errs
+}
+
+// applyEmployeeRows writes rows according to the conflict policy, updating existing employees
+// before inserting new ones, and reports how each one compared to the employee already stored
+// under its ID. Rows the policy does not allow,
+// e.g. existing employees for insertOnly, are reported as a *ValidationError. Rows may take over
+// logins released by other rows of the same file, e.g. to swap the logins of two employees, but a
+// login held by an employee the file does not rename is reported as a conflict. The employees that
+// change are snapshotted under uploadID. Employees are locked as they are read, so their snapshot
+// is what the rows overwrite. Rows whose login is held by an employee that pending reports a later
+// row may still rename are not written but returned, to be written along with that row.
+func (h *employeeHandler) applyEmployeeRows(txn boil.Transactor, uploadID int64, rows []employeeRow, policy string, pending func(holderID string) bool) (*domains.EmployeeDiff, []employeeRow, error) {
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.Employee.ID)
+	}
+	existing, err := h.employeesDAO.GetByIDsForUpdate(txn, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	current := make(map[string]domains.EmployeeReqResp, len(existing))
+	for _, employee := range existing {
+		current[daos.CollationKey(employee.ID)] = toEmployeeReqResp(*employee)
+	}
+
+	diff := &domains.EmployeeDiff{
+		Inserted:  []string{},
+		Updated:   []domains.EmployeeChange{},
+		Unchanged: []string{},
+		Skipped:   []string{},
+		Deleted:   []string{},
+	}
+	rows, err = h.applyPolicy(rows, current, policy, diff)
+	if err != nil {
+		return nil, nil, err
+	}
+	logins := make([]string, 0, len(rows))
+	for _, row := range rows {
+		logins = append(logins, row.Employee.Login)
+	}
+	rows, carried, err := h.checkLoginConflicts(txn, rows, logins, pending)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claimedLogins := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		claimedLogins[daos.CollationKey(row.Employee.Login)] = true
+	}
+	var inserted, updated []models.Employee
+	var snapshots []domains.EmployeeSnapshot
+	var released []string
+	for _, row := range rows {
+		after := toEmployeeReqResp(row.Employee)
+		before, exists := current[daos.CollationKey(row.Employee.ID)]
+		if exists && before == after {
+			diff.Unchanged = append(diff.Unchanged, row.Employee.ID)
+			continue
+		}
+
+		snapshot := domains.EmployeeSnapshot{EmployeeID: row.Employee.ID, After: &after}
+		if exists {
+			snapshot.Before = &before
+		}
+		snapshots = append(snapshots, snapshot)
+		if exists {
+			updated = append(updated, row.Employee)
+			diff.Updated = append(diff.Updated, domains.EmployeeChange{
+				ID:     row.Employee.ID,
+				Before: before,
+				After:  after,
+			})
+			oldLogin := daos.CollationKey(before.Login)
+			if oldLogin != daos.CollationKey(after.Login) && claimedLogins[oldLogin] {
+				released = append(released, row.Employee.ID)
+			}
+		} else {
+			inserted = append(inserted, row.Employee)
+			diff.Inserted = append(diff.Inserted, row.Employee.ID)
+		}
+	}
+
+	if err := h.employeesDAO.ReleaseLogins(txn, released); err != nil {
+		return nil, nil, err
+	}
+	// updates go first, as they may free logins taken by new employees
+	if err := h.employeesDAO.UpdateEmployees(txn, updated, h.uploadConfig.BatchSize); err != nil {
+		return nil, nil, err
+	}
+	if err := h.employeesDAO.InsertEmployees(txn, inserted, h.uploadConfig.BatchSize); err != nil {
+		return nil, nil, err
+	}
+	if err := h.uploadsDAO.AddSnapshots(txn, uploadID, snapshots); err != nil {
+		return nil, nil, err
+	}
+	return diff, carried, nil
+}
+
+// deleteAbsentEmployees deletes every employee whose ID is not listed, after the file was applied,
+// adding them to the diff and snapshotting them under uploadID. If that is more than maxPercent
+// of the employees that existed before the upload, a *SyncThresholdError is returned instead.
+// Every employee is locked as the IDs are read, so none can change between being snapshotted and
+// deleted.
+func (h *employeeHandler) deleteAbsentEmployees(txn boil.Transactor, uploadID int64, listed map[string]bool, diff *domains.EmployeeDiff, maxPercent float64) error {
+	empIDs, err := h.employeesDAO.GetAllIDsForUpdate(txn)
+	if err != nil {
+		return err
+	}
+	var absent []string
+	for _, empID := range empIDs {
+		if !listed[daos.CollationKey(empID)] {
+			absent = append(absent, empID)
+		}
+	}
+	if len(absent) == 0 {
+		return nil
+	}
+	existing := len(empIDs) - len(diff.Inserted)
+	if float64(len(absent))*100 > maxPercent*float64(existing) {
+		return &SyncThresholdError{Deleted: len(absent), Existing: existing, MaxPercent: maxPercent}
+	}
+
+	employees, err := h.employeesDAO.GetByIDsForUpdate(txn, absent)
+	if err != nil {
+		return err
+	}
+	snapshots := make([]domains.EmployeeSnapshot, 0, len(employees))
+	for _, employee := range employees {
+		before := toEmployeeReqResp(*employee)
+		snapshots = append(snapshots, domains.EmployeeSnapshot{EmployeeID: employee.ID, Before: &before})
+	}
+	if err := h.employeesDAO.DeleteEmployees(txn, absent); err != nil {
+		return err
+	}
+	if err := h.uploadsDAO.AddSnapshots(txn, uploadID, snapshots); err != nil {
+		return err
+	}
+	diff.Deleted = absent
+	return nil
+}
+
+// applyPolicy returns the rows to write under a conflict policy, given the current employees by
+// collation key. Existing employees the policy skips are added to the diff, and rows that the
+// policy forbids are reported as a *ValidationError.
+func (h *employeeHandler) applyPolicy(rows []employeeRow, current map[string]domains.EmployeeReqResp, policy string, diff *domains.EmployeeDiff) ([]employeeRow, error) {
+	var applied []employeeRow
+	var rowErrors []domains.RowError
+	for _, row := range rows {
+		_, exists := current[daos.CollationKey(row.Employee.ID)]
+		action, err := h.employeesDAO.ResolvePolicy(policy, exists)
+		switch {
+		case errors.Is(err, daos.ErrEmployeeExists):
+			rowErrors = append(rowErrors, domains.RowError{
+				Line:       row.Line,
+				EmployeeID: row.Employee.ID,
+				Field:      "id",
+				Reason:     fmt.Sprintf("%v: %v uploads may only add employees", err, policy),
+			})
+		case errors.Is(err, daos.ErrEmployeeNotFound):
+			rowErrors = append(rowErrors, domains.RowError{
+				Line:       row.Line,
+				EmployeeID: row.Employee.ID,
+				Field:      "id",
+				Reason:     fmt.Sprintf("%v: %v uploads may only change existing employees", err, policy),
+			})
+		case action == daos.PolicySkip:
+			diff.Skipped = append(diff.Skipped, row.Employee.ID)
+		default:
+			applied = append(applied, row)
+		}
+	}
+	if len(rowErrors) > 0 {
+		return nil, &ValidationError{Errors: rowErrors}
+	}
+	return applied, nil
+}
+
+// checkLoginConflicts returns a *ValidationError for every row whose login is held by an
+// employee that keeps it, either because the file does not mention that employee or because
+// the file leaves its login as is. Otherwise it returns the rows to write and the rows to carry
+// over, as reported by loginConflicts.
+func (h *employeeHandler) checkLoginConflicts(txn boil.Transactor, rows []employeeRow, logins []string, pending func(holderID string) bool) ([]employeeRow, []employeeRow, error) {
+	holders, err := h.employeesDAO.GetByLoginsForUpdate(txn, logins)
+	if err != nil {
+		return nil, nil, err
+	}
+	holderIDs := make(map[string]string, len(holders))
+	for _, holder := range holders {
+		holderIDs[daos.CollationKey(holder.Login)] = holder.ID
+	}
+	written, carried, rowErrors := loginConflicts(rows, holderIDs, pending)
+	if len(rowErrors) > 0 {
+		return nil, nil, &ValidationError{Errors: rowErrors}
+	}
+	return written, carried, nil
+}
+
+// loginConflicts splits rows, given the IDs of the employees holding their logins by collation
+// key, into the rows that can be written and the rows whose login is held by an employee that
+// pending reports a later row may still rename. Rows that need a carried row to release their
+// login are carried over as well. Any other row whose login is held is a conflict.
+func loginConflicts(rows []employeeRow, holderIDs map[string]string, pending func(holderID string) bool) ([]employeeRow, []employeeRow, []domains.RowError) {
+	var carried []employeeRow
+	carriedIDs := map[string]bool{}
+	for {
+		finalLogins := make(map[string]string, len(rows))
+		for _, row := range rows {
+			finalLogins[daos.CollationKey(row.Employee.ID)] = daos.CollationKey(row.Employee.Login)
+		}
+
+		var written, later []employeeRow
+		var rowErrors []domains.RowError
+		for _, row := range rows {
+			login := daos.CollationKey(row.Employee.Login)
+			holderID, held := holderIDs[login]
+			if !held || daos.CollationKey(holderID) == daos.CollationKey(row.Employee.ID) {
+				written = append(written, row)
+				continue
+			}
+			if holderLogin, inFile := finalLogins[daos.CollationKey(holderID)]; inFile && holderLogin != login {
+				// the holder is renamed by this file, releasing the login
+				written = append(written, row)
+				continue
+			}
+			if carriedIDs[daos.CollationKey(holderID)] || pending(holderID) {
+				later = append(later, row)
+				continue
+			}
+			rowErrors = append(rowErrors, domains.RowError{
+				Line:       row.Line,
+				EmployeeID: row.Employee.ID,
+				Field:      "login",
+				Reason:     fmt.Sprintf("Login conflict: %v is already used by employee %v", row.Employee.Login, holderID),
+			})
+		}
+		if len(rowErrors) > 0 || len(later) == 0 {
+			return written, carried, rowErrors
+		}
+		// the rows left may have relied on a carried row releasing its login
+		for _, row := range later {
+			carriedIDs[daos.CollationKey(row.Employee.ID)] = true
+		}
+		carried = append(carried, later...)
+		rows = written
+	}
+}
+
+func toEmployeeReqResp(employee models.Employee) domains.EmployeeReqResp {
+	return domains.EmployeeReqResp{
+		Name:   employee.Name,
+		Login:  employee.Login,
+		Salary: employee.Salary.Float64,
+	}
+}
+
+// validateRecord checks a record against the column mapping and the column constraints of the
+// employees table, returning every problem found.
+func validateRecord(record *csvreader.Record, mapping columnMapping) (models.Employee, []domains.RowError) {
+	fields := record.Fields
+	if (mapping.header && len(fields) < mapping.width()) || (!mapping.header && len(fields) != len(employeeColumns)) {
+		rowError := domains.RowError{
+			Line:   record.Line,
+			Reason: fmt.Sprintf("Missing employee fields: ID, login, name and salary fields are all required, got %v field(s)", len(fields)),
+		}
+		if mapping.indexes["id"] < len(fields) {
+			rowError.EmployeeID = fields[mapping.indexes["id"]]
+		}
+		return models.Employee{}, []domains.RowError{rowError}
+	}
+	cols := make([]string, len(employeeColumns))
+	for i, col := range employeeColumns {
+		cols[i] = fields[mapping.indexes[col]]
+	}
+
+	var errs []domains.RowError
+	fieldError := func(field string, reason string) {
+		errs = append(errs, domains.RowError{
+			Line:       record.Line,
+			EmployeeID: cols[0],
+			Field:      field,
+			Reason:     reason,
+		})
+	}
+
+	checkString := func(field string, value string, maxLength int) {
+		if value == "" {
+			fieldError(field, fmt.Sprintf("Missing employee field: %v is required", field))
+		} else if utf8.RuneCountInString(value) > maxLength {
+			fieldError(field, fmt.Sprintf("Invalid employee field: %v should be at most %v characters", field, maxLength))
+		} else if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			fieldError(field, fmt.Sprintf("Invalid employee field: %v should not contain control characters", field))
+		}
+	}
+	checkString("id", cols[0], maxIDLength)
+	checkString("login", cols[1], maxLoginLength)
+	checkString("name", cols[2], maxNameLength)
+
+	salary, err := strconv.ParseFloat(cols[3], 64)
+	if cols[3] == "" {
+		fieldError("salary", "Missing employee field: salary is required")
+	} else if err != nil || salary < 0 || math.IsNaN(salary) || math.IsInf(salary, 0) {
+		fieldError("salary", "Invalid employee field: Salary should be a decimal that is >= 0.0")
+	}
+
+	return models.Employee{
+		ID:     cols[0],
+		Login:  cols[1],
+		Name:   cols[2],
+		Salary: null.Float64From(salary),
+	}, errs
+}
+
+// parseDelimiter accepts ",", ";" or a tab (either "\t" or "tab"), defaulting to ",".
+func parseDelimiter(s string) (rune, error) {
+	switch s {
+	case "", ",":
+		return ',', nil
+	case ";":
+		return ';', nil
+	case "\t", "\\t", "tab":
+		return '\t', nil
+	}
+	return 0, errors.New("Invalid data format: delimiter should be \",\", \";\" or \"tab\"")
+}
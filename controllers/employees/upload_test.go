@@ -0,0 +1,188 @@
+package employees
+
+import (
+	"awesomeProject/daos"
+	"awesomeProject/models"
+	"awesomeProject/utils/csvreader"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadEmployeeRowsHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantHeader bool
+		wantRows   int
+		wantErrors []int // lines
+	}{
+		{
+			name:       "header",
+			input:      "login,id,name,salary\nhpotter,e0001,Harry Potter,1234.00\n",
+			wantHeader: true,
+			wantRows:   1,
+		},
+		{
+			name:     "no header",
+			input:    "e0001,hpotter,Harry Potter,1234.00\ne0002,rwesley,Ron Weasley,19234.50\n",
+			wantRows: 2,
+		},
+		{
+			name:       "header after a broken first record",
+			input:      "e0001,hpotter,\"Harry\" Potter,1234.00\nid,login,name,salary\ne0002,rwesley,Ron Weasley,19234.50\n",
+			wantRows:   1,
+			wantErrors: []int{1, 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, rows, err := readEmployeeRows(csvreader.NewReader(strings.NewReader(test.input)), DefaultColumnAliases, 100)
+			if err != nil {
+				t.Fatalf("readEmployeeRows() returned error %v", err)
+			}
+			if (file.header != nil) != test.wantHeader {
+				t.Errorf("readEmployeeRows() read header %v, want a header: %v", file.header, test.wantHeader)
+			}
+			if len(rows) != test.wantRows {
+				t.Errorf("readEmployeeRows() read %v rows, want %v", len(rows), test.wantRows)
+			}
+			var lines []int
+			for _, rowError := range file.errors {
+				if len(lines) == 0 || lines[len(lines)-1] != rowError.Line {
+					lines = append(lines, rowError.Line)
+				}
+			}
+			if !reflect.DeepEqual(lines, test.wantErrors) {
+				t.Errorf("readEmployeeRows() returned errors on lines %v, want %v", lines, test.wantErrors)
+			}
+		})
+	}
+}
+
+func TestLoginConflicts(t *testing.T) {
+	row := func(line int, id string, login string) employeeRow {
+		return employeeRow{Line: line, Employee: models.Employee{ID: id, Login: login}}
+	}
+	// hpotter is held by e0001, rwesley by e0002 and hgranger by e0003
+	holderIDs := map[string]string{
+		daos.CollationKey("hpotter"):  "e0001",
+		daos.CollationKey("rwesley"):  "e0002",
+		daos.CollationKey("hgranger"): "e0003",
+	}
+	tests := []struct {
+		name        string
+		rows        []employeeRow
+		pending     string // ID of the employee a later row may rename
+		wantWritten []int  // lines
+		wantCarried []int
+		wantErrors  []int
+	}{
+		{
+			name:        "free and own logins",
+			rows:        []employeeRow{row(1, "e0001", "hpotter"), row(2, "e0004", "nlongbottom")},
+			wantWritten: []int{1, 2},
+		},
+		{
+			name:        "swap within the batch",
+			rows:        []employeeRow{row(1, "e0001", "rwesley"), row(2, "e0002", "hpotter")},
+			wantWritten: []int{1, 2},
+		},
+		{
+			name:       "holder keeps its login",
+			rows:       []employeeRow{row(1, "e0004", "hpotter")},
+			wantErrors: []int{1},
+		},
+		{
+			name:        "holder not read yet",
+			rows:        []employeeRow{row(1, "e0004", "hpotter"), row(2, "e0005", "lluna")},
+			pending:     "e0001",
+			wantWritten: []int{2},
+			wantCarried: []int{1},
+		},
+		{
+			name:        "login released by a carried row",
+			rows:        []employeeRow{row(1, "e0002", "hpotter"), row(2, "e0003", "rwesley"), row(3, "e0004", "hgranger")},
+			pending:     "e0001",
+			wantCarried: []int{1, 2, 3},
+		},
+		{
+			name:       "holder not read yet at the end of the file",
+			rows:       []employeeRow{row(1, "e0004", "hpotter")},
+			wantErrors: []int{1},
+		},
+	}
+	lines := func(rows []employeeRow) []int {
+		var lines []int
+		for _, row := range rows {
+			lines = append(lines, row.Line)
+		}
+		return lines
+	}
+	for _, test := range tests {
+		pending := func(holderID string) bool { return holderID == test.pending }
+		written, carried, rowErrors := loginConflicts(test.rows, holderIDs, pending)
+		var errorLines []int
+		for _, rowError := range rowErrors {
+			errorLines = append(errorLines, rowError.Line)
+		}
+		if len(rowErrors) == 0 && (!reflect.DeepEqual(lines(written), test.wantWritten) || !reflect.DeepEqual(lines(carried), test.wantCarried)) {
+			t.Errorf("loginConflicts(%v) wrote lines %v and carried %v, want %v and %v", test.name, lines(written), lines(carried), test.wantWritten, test.wantCarried)
+		}
+		if !reflect.DeepEqual(errorLines, test.wantErrors) {
+			t.Errorf("loginConflicts(%v) returned errors on lines %v, want %v", test.name, errorLines, test.wantErrors)
+		}
+	}
+}
+
+func TestUploaderIdentity(t *testing.T) {
+	h := &employeeHandler{uploadConfig: UploadConfig{TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16"}}}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+		wantIP     string
+	}{
+		{"client", "203.0.113.7:4242", nil, "203.0.113.7", "203.0.113.7"},
+		{"X-Uploader from a client", "203.0.113.7:4242", http.Header{"X-Uploader": {"admin"}}, "203.0.113.7", "203.0.113.7"},
+		{"basic auth user", "203.0.113.7:4242", http.Header{"Authorization": {"Basic YWRtaW46"}}, "203.0.113.7", "203.0.113.7"},
+		{"X-Uploader from a trusted proxy", "10.0.0.1:4242", http.Header{"X-Uploader": {" hpotter "}}, "hpotter", "10.0.0.1"},
+		{"X-Uploader from a trusted range", "192.168.3.4:4242", http.Header{"X-Uploader": {"hpotter"}}, "hpotter", "192.168.3.4"},
+		{"trusted proxy without X-Uploader", "10.0.0.1:4242", nil, "10.0.0.1", "10.0.0.1"},
+	}
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/users/upload", nil)
+		c.Request.RemoteAddr = test.remoteAddr
+		for name, values := range test.header {
+			c.Request.Header[name] = values
+		}
+		uploader, uploaderIP := h.uploaderIdentity(c)
+		if uploader != test.want || uploaderIP != test.wantIP {
+			t.Errorf("uploaderIdentity(%v) = %q, %q, want %q, %q", test.name, uploader, uploaderIP, test.want, test.wantIP)
+		}
+	}
+}
+
+// readEmployeeRows reads every row of a file.
+func readEmployeeRows(reader recordReader, aliases map[string]string, maxRows int) (*employeeFile, []employeeRow, error) {
+	rows := newEmployeeRowReader(reader, aliases, maxRows)
+	var valid []employeeRow
+	for {
+		row, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			return rows.file, valid, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		valid = append(valid, row)
+	}
+}
@@ -0,0 +1,278 @@
+package employees
+
+import (
+	"awesomeProject/daos"
+	"awesomeProject/domains"
+	"awesomeProject/models"
+	"awesomeProject/utils/db"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+// RevertConflictError lists the employees that prevent an upload from being reverted.
+type RevertConflictError struct {
+	Conflicts []domains.RevertConflict
+}
+
+func (e *RevertConflictError) Error() string {
+	return fmt.Sprintf("Upload cannot be reverted: %v employees changed after it", len(e.Conflicts))
+}
+
+var errNotRevertable = errors.New("Upload cannot be reverted: only uploads that were applied and not yet reverted can be reverted")
+
+// getUploads returns the upload history, most recent first.
+func (h *employeeHandler) getUploads(c *gin.Context) {
+	limit := 30
+	offset := 0
+
+	var err error
+	limitString, present := c.GetQuery("limit")
+	if present && limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 0 {
+			c.Error(errors.New("Invalid data format: limit should be a non-negative integer"))
+			c.JSON(http.StatusBadRequest, c.Errors.Last())
+			return
+		}
+	}
+
+	offsetString, present := c.GetQuery("offset")
+	if present && offsetString != "" {
+		offset, err = strconv.Atoi(offsetString)
+		if err != nil || offset < 0 {
+			c.Error(errors.New("Invalid data format: offset should be a non-negative integer"))
+			c.JSON(http.StatusBadRequest, c.Errors.Last())
+			return
+		}
+	}
+
+	uploads, err := h.uploadsDAO.GetAll(boil.GetDB(), limit, offset)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+	c.JSON(http.StatusOK, &domains.AllUploadsResp{Results: uploads})
+}
+
+func (h *employeeHandler) getUploadByID(c *gin.Context) {
+	uploadID, ok := parseUploadID(c)
+	if !ok {
+		return
+	}
+	upload, err := h.uploadsDAO.GetByID(boil.GetDB(), uploadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.Error(errors.New(fmt.Sprintf("Upload with ID %v does not exist", uploadID)))
+		c.JSON(http.StatusNotFound, c.Errors.Last())
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+	c.JSON(http.StatusOK, upload)
+}
+
+// getRejects downloads the rows a partial upload rejected as a CSV file.
+func (h *employeeHandler) getRejects(c *gin.Context) {
+	uploadID, ok := parseUploadID(c)
+	if !ok {
+		return
+	}
+	rejects, err := h.uploadsDAO.GetRejects(boil.GetDB(), uploadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.Error(errors.New(fmt.Sprintf("Upload with ID %v has no rejected rows", uploadID)))
+		c.JSON(http.StatusNotFound, c.Errors.Last())
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="upload-%v-rejects.csv"`, uploadID))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", []byte(rejects))
+}
+
+// revertUpload restores every employee an upload changed to its state before the upload, and
+// deletes the employees it inserted. The revert is refused with a list of conflicts if any of
+// those employees changed after the upload.
+func (h *employeeHandler) revertUpload(c *gin.Context) {
+	uploadID, ok := parseUploadID(c)
+	if !ok {
+		return
+	}
+	if _, err := h.uploadsDAO.GetByID(boil.GetDB(), uploadID); errors.Is(err, sql.ErrNoRows) {
+		c.Error(errors.New(fmt.Sprintf("Upload with ID %v does not exist", uploadID)))
+		c.JSON(http.StatusNotFound, c.Errors.Last())
+		return
+	} else if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+
+	var response domains.UploadRevertResp
+	err := db.WithTxn(func(txn boil.Transactor) error {
+		reverted, err := h.uploadsDAO.MarkReverted(txn, uploadID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if !reverted {
+			return errNotRevertable
+		}
+		response.Restored, response.Deleted, err = h.restoreSnapshots(txn, uploadID)
+		if err != nil {
+			return err
+		}
+		upload, err := h.uploadsDAO.GetByID(txn, uploadID)
+		if err != nil {
+			return err
+		}
+		response.Upload = *upload
+		return nil
+	})
+	var conflictErr *RevertConflictError
+	if errors.As(err, &conflictErr) {
+		c.Error(err).SetMeta(gin.H{"conflicts": conflictErr.Conflicts})
+		c.JSON(http.StatusConflict, c.Errors.Last())
+		return
+	}
+	if errors.Is(err, errNotRevertable) {
+		c.Error(err)
+		c.JSON(http.StatusConflict, c.Errors.Last())
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return
+	}
+	c.JSON(http.StatusOK, &response)
+}
+
+// restoreSnapshots puts the employees snapshotted by an upload back the way they were, returning
+// the IDs of the restored and deleted employees. The employees and the logins they get back are
+// locked as they are read, so a change made in the meantime is either seen as a conflict or waits
+// for the revert, rather than being overwritten.
+func (h *employeeHandler) restoreSnapshots(txn boil.Transactor, uploadID int64) ([]string, []string, error) {
+	snapshots, err := h.uploadsDAO.GetSnapshots(txn, uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]string, 0, len(snapshots))
+	inSnapshots := make(map[string]bool, len(snapshots))
+	var beforeLogins []string
+	for _, snapshot := range snapshots {
+		ids = append(ids, snapshot.EmployeeID)
+		inSnapshots[daos.CollationKey(snapshot.EmployeeID)] = true
+		if snapshot.Before != nil {
+			beforeLogins = append(beforeLogins, snapshot.Before.Login)
+		}
+	}
+
+	existing, err := h.employeesDAO.GetByIDsForUpdate(txn, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	current := make(map[string]domains.EmployeeReqResp, len(existing))
+	for _, employee := range existing {
+		current[daos.CollationKey(employee.ID)] = toEmployeeReqResp(*employee)
+	}
+	holders, err := h.employeesDAO.GetByLoginsForUpdate(txn, beforeLogins)
+	if err != nil {
+		return nil, nil, err
+	}
+	holderIDs := make(map[string]string, len(holders))
+	for _, holder := range holders {
+		holderIDs[daos.CollationKey(holder.Login)] = holder.ID
+	}
+
+	var conflicts []domains.RevertConflict
+	restored := []string{}
+	deleted := []string{}
+	var updated, inserted []models.Employee
+	var released []string
+	for _, snapshot := range snapshots {
+		actual, exists := current[daos.CollationKey(snapshot.EmployeeID)]
+		conflict := domains.RevertConflict{EmployeeID: snapshot.EmployeeID, Expected: snapshot.After}
+		if exists {
+			conflict.Actual = &actual
+		}
+		switch {
+		case snapshot.After == nil && exists:
+			conflict.Reason = "Employee was added again after the upload"
+			conflicts = append(conflicts, conflict)
+			continue
+		case snapshot.After != nil && !exists:
+			conflict.Reason = "Employee was deleted after the upload"
+			conflicts = append(conflicts, conflict)
+			continue
+		case snapshot.After != nil && actual != *snapshot.After:
+			conflict.Reason = "Employee was modified after the upload"
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+
+		if snapshot.Before == nil {
+			deleted = append(deleted, snapshot.EmployeeID)
+			continue
+		}
+		if holderID, held := holderIDs[daos.CollationKey(snapshot.Before.Login)]; held && !inSnapshots[daos.CollationKey(holderID)] {
+			conflict.Reason = fmt.Sprintf("Login conflict: %v has since been taken by employee %v", snapshot.Before.Login, holderID)
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+		restored = append(restored, snapshot.EmployeeID)
+		employee := models.Employee{
+			ID:     snapshot.EmployeeID,
+			Login:  snapshot.Before.Login,
+			Name:   snapshot.Before.Name,
+			Salary: null.Float64From(snapshot.Before.Salary),
+		}
+		if !exists {
+			inserted = append(inserted, employee)
+			continue
+		}
+		updated = append(updated, employee)
+		if daos.CollationKey(actual.Login) != daos.CollationKey(snapshot.Before.Login) {
+			released = append(released, snapshot.EmployeeID)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, nil, &RevertConflictError{Conflicts: conflicts}
+	}
+
+	if err := h.employeesDAO.DeleteEmployees(txn, deleted); err != nil {
+		return nil, nil, err
+	}
+	if err := h.employeesDAO.ReleaseLogins(txn, released); err != nil {
+		return nil, nil, err
+	}
+	if err := h.employeesDAO.UpdateEmployees(txn, updated, h.uploadConfig.BatchSize); err != nil {
+		return nil, nil, err
+	}
+	if err := h.employeesDAO.InsertEmployees(txn, inserted, h.uploadConfig.BatchSize); err != nil {
+		return nil, nil, err
+	}
+	return restored, deleted, nil
+}
+
+func parseUploadID(c *gin.Context) (int64, bool) {
+	uploadID, err := strconv.ParseInt(c.Param("uploadID"), 10, 64)
+	if err != nil {
+		c.Error(errors.New("Invalid data format: upload ID should be an integer"))
+		c.JSON(http.StatusBadRequest, c.Errors.Last())
+		return 0, false
+	}
+	return uploadID, true
+}
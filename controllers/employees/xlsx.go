@@ -0,0 +1,41 @@
+package employees
+
+import (
+	"awesomeProject/utils/csvreader"
+	"awesomeProject/utils/xlsx"
+	"strings"
+)
+
+// xlsxRecordReader reads worksheet rows as records, skipping rows whose first cell starts with #
+// like comment lines in a CSV file.
+type xlsxRecordReader struct {
+	*xlsx.Reader
+	comments int
+}
+
+func (r *xlsxRecordReader) Read() (*csvreader.Record, error) {
+	for {
+		row, err := r.Reader.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		fields := make([]string, len(row.Cells))
+		for i, cell := range row.Cells {
+			fields[i] = strings.TrimSpace(cell)
+		}
+		if strings.HasPrefix(fields[0], "#") {
+			r.comments++
+			continue
+		}
+		return &csvreader.Record{
+			Line:   row.Number,
+			Fields: fields,
+			Raw:    csvreader.Join(row.Cells, ','),
+		}, nil
+	}
+}
+
+func (r *xlsxRecordReader) Comments() int {
+	return r.comments
+}
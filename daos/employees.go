@@ -3,26 +3,139 @@ package daos
 import (
 	"awesomeProject/domains"
 	"awesomeProject/models"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/volatiletech/null/v8"
 	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
 )
 
+// EmployeesDAO stores the employees. The methods listing employees take a salary range and a
+// search, matching employees whose name or login contains the search regardless of case and
+// accents, and list the employees found by a search without a sort by how well they match.
 type EmployeesDAO interface {
 	AddEmployee(exec boil.Executor, employee models.Employee) error
+	Count(exec boil.Executor, minSalary null.Float64, maxSalary null.Float64, search string) (int64, error)
 	DeleteEmployee(exec boil.Executor, empID string) error
-	GetAll(exec boil.Executor, minSalary null.Float64, maxSalary null.Float64, sort null.String, order null.String, limit int, offset int) (*models.EmployeeSlice, error)
+	DeleteEmployees(exec boil.Executor, empIDs []string) error
+	EachEmployee(exec boil.Executor, minSalary null.Float64, maxSalary null.Float64, search string, sort []domains.SortKey, fn func(employee *models.Employee) error) error
+	GetAllIDsForUpdate(exec boil.Executor) ([]string, error)
+	GetAll(exec boil.Executor, minSalary null.Float64, maxSalary null.Float64, search string, sort []domains.SortKey, limit int, offset int) (*models.EmployeeSlice, error)
+	GetAfter(exec boil.Executor, minSalary null.Float64, maxSalary null.Float64, search string, sort []domains.SortKey, after *models.Employee, limit int) (models.EmployeeSlice, error)
 	GetByID(exec boil.Executor, empID string) (*models.Employee, error)
+	GetByIDsForUpdate(exec boil.Executor, empIDs []string) (models.EmployeeSlice, error)
+	GetByLoginsForUpdate(exec boil.Executor, logins []string) (models.EmployeeSlice, error)
+	InsertEmployees(exec boil.Executor, employees []models.Employee, batchSize int) error
+	ResolvePolicy(policy string, exists bool) (PolicyAction, error)
+	ReleaseLogins(exec boil.Executor, empIDs []string) error
 	UpdateEmployee(exec boil.Executor, employee domains.EmployeeReqResp, empID string) error
+	UpdateEmployees(exec boil.Executor, employees []models.Employee, batchSize int) error
 	UpsertEmployee(exec boil.Executor, employee models.Employee) error
 }
 
+// maxInListSize keeps the IN lists of queries on many employees a reasonable size.
+const maxInListSize = 1000
+
+// generalCIFolds lists the letters that utf8mb4_general_ci compares the letters of the Latin-1
+// Supplement and Latin Extended-A blocks as, from U+00C0 on: the base letter of accented letters,
+// and the capital of letters it does not fold, such as Æ and Ø.
+const generalCIFolds = "AAAAAAÆCEEEEIIIIÐNOOOOO×ØUUUUYÞS" + // U+00C0
+	"AAAAAAÆCEEEEIIIIÐNOOOOO÷ØUUUUYÞY" + // U+00E0
+	"AAAAAACCCCCCCCDDĐĐEEEEEEEEEEGGGG" + // U+0100
+	"GGGGHHĦĦIIIIIIIIIIĲĲJJKKĸLLLLLLĿ" + // U+0120
+	"ĿŁŁNNNNNNŉŊŊOOOOOOŒŒRRRRRRSSSSSS" + // U+0140
+	"SSTTTTŦŦUUUUUUUUUUUUWWYYYZZZZZZS" //   U+0160
+
+var generalCIFoldTable = []rune(generalCIFolds)
+
+// CollationKey approximates how the utf8mb4_general_ci collation of the employees table compares
+// IDs and logins: ignoring case, trailing spaces and the accents of Latin letters, so that josé
+// and JOSE are the same login, and comparing every character outside the Basic Multilingual Plane
+// as equal. Where it does not match MySQL, writes fail with a duplicate key error rather than
+// change another employee, as they never update on a duplicate key.
+func CollationKey(s string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimRight(s, " ") {
+		switch {
+		case r >= 0xC0 && r < 0xC0+rune(len(generalCIFoldTable)):
+			r = generalCIFoldTable[r-0xC0]
+		case r > 0xFFFF:
+			r = unicode.ReplacementChar
+		default:
+			r = unicode.ToUpper(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// eachChunk calls fn with the bounds of consecutive chunks of up to size out of n values, stopping
+// at the first error.
+func eachChunk(n int, size int, fn func(start int, end int) error) error {
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		if err := fn(start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PolicyAction is what a conflict policy does with an employee that is allowed.
+type PolicyAction int
+
+const (
+	// PolicyNone is no action, returned with the error for an employee the policy does not allow.
+	PolicyNone PolicyAction = iota
+	// PolicyWrite inserts the employee, or updates it if its ID exists.
+	PolicyWrite
+	// PolicySkip leaves the existing employee as it is.
+	PolicySkip
+)
+
+var (
+	ErrEmployeeExists   = errors.New("Employee already exists")
+	ErrEmployeeNotFound = errors.New("Employee does not exist")
+)
+
+// maxBatchSize keeps a multi-row statement of employees under MySQL's limit of 65535
+// placeholders.
+const maxBatchSize = 65535 / 4
+
 type employeesDAO struct{}
 
 func NewEmployeesDAO() *employeesDAO {
 	return &employeesDAO{}
 }
+
+// ResolvePolicy decides what a conflict policy does with an employee, depending on whether its ID
+// exists, returning either an action or, if the policy does not allow the employee, an error:
+//   - upsert inserts new employees and updates existing ones
+//   - insertOnly fails existing employees with ErrEmployeeExists
+//   - updateOnly fails new employees with ErrEmployeeNotFound
+//   - skipExisting inserts new employees and skips existing ones
+//
+// Importers decide with ResolvePolicy and then write with InsertEmployees and UpdateEmployees, so
+// they all share the same semantics.
+func (dao *employeesDAO) ResolvePolicy(policy string, exists bool) (PolicyAction, error) {
+	switch {
+	case exists && policy == domains.PolicyInsertOnly:
+		return PolicyNone, ErrEmployeeExists
+	case !exists && policy == domains.PolicyUpdateOnly:
+		return PolicyNone, ErrEmployeeNotFound
+	case exists && policy == domains.PolicySkipExisting:
+		return PolicySkip, nil
+	default:
+		return PolicyWrite, nil
+	}
+}
 func (dao *employeesDAO) AddEmployee(exec boil.Executor, employee models.Employee) error {
 	err := employee.Insert(exec, boil.Infer())
 	if err != nil {
@@ -31,6 +144,11 @@ func (dao *employeesDAO) AddEmployee(exec boil.Executor, employee models.Employe
 	return nil
 }
 
+// Count returns the number of employees whose salary is within the range and that match search.
+func (dao *employeesDAO) Count(exec boil.Executor, minSalary null.Float64, maxSalary null.Float64, search string) (int64, error) {
+	return models.Employees(filterMods(minSalary, maxSalary, search)...).Count(exec)
+}
+
 func (dao *employeesDAO) DeleteEmployee(exec boil.Executor, empID string) error {
 	employeeInDB, err := dao.GetByID(exec, empID)
 	if err != nil {
@@ -43,22 +161,47 @@ func (dao *employeesDAO) DeleteEmployee(exec boil.Executor, empID string) error
 	return nil
 }
 
-func (dao *employeesDAO) GetAll(exec boil.Executor, minSalary null.Float64, maxSalary null.Float64, sort null.String, order null.String, limit int, offset int) (*models.EmployeeSlice, error) {
-	var queryMods []qm.QueryMod
+// DeleteEmployees deletes the given employees, ignoring IDs that do not exist.
+func (dao *employeesDAO) DeleteEmployees(exec boil.Executor, empIDs []string) error {
+	return eachChunk(len(empIDs), maxInListSize, func(start int, end int) error {
+		_, err := models.Employees(models.EmployeeWhere.ID.IN(empIDs[start:end])).DeleteAll(exec)
+		return err
+	})
+}
 
-	if !minSalary.IsZero() {
-		queryMods = append(queryMods, models.EmployeeWhere.Salary.GTE(minSalary))
-	}
+// EachEmployee calls fn with every employee whose salary is within the range and that matches
+// search, in order of sort and then of their ID, stopping at the first error. The employees are
+// read with a cursor, one at a time, rather than loaded into memory all at once, so that fn can
+// stream them.
+func (dao *employeesDAO) EachEmployee(exec boil.Executor, minSalary null.Float64, maxSalary null.Float64, search string, sort []domains.SortKey, fn func(employee *models.Employee) error) error {
+	queryMods := filterMods(minSalary, maxSalary, search)
+	queryMods = append(queryMods,
+		qm.Select(models.EmployeeColumns.ID, models.EmployeeColumns.Login, models.EmployeeColumns.Name, models.EmployeeColumns.Salary),
+		orderByMod(sort, search),
+	)
 
-	if !maxSalary.IsZero() {
-		queryMods = append(queryMods, models.EmployeeWhere.Salary.LTE(maxSalary))
+	rows, err := models.Employees(queryMods...).Query.Query(exec)
+	if err != nil {
+		return err
 	}
-
-	if !sort.IsZero() && !order.IsZero() {
-		queryMods = append(queryMods, qm.OrderBy(sort.String+" "+order.String))
+	defer rows.Close()
+	for rows.Next() {
+		var employee models.Employee
+		if err := rows.Scan(&employee.ID, &employee.Login, &employee.Name, &employee.Salary); err != nil {
+			return err
+		}
+		if err := fn(&employee); err != nil {
+			return err
+		}
 	}
+	return rows.Err()
+}
+
+func (dao *employeesDAO) GetAll(exec boil.Executor, minSalary null.Float64, maxSalary null.Float64, search string, sort []domains.SortKey, limit int, offset int) (*models.EmployeeSlice, error) {
+	queryMods := filterMods(minSalary, maxSalary, search)
 
 	queryMods = append(queryMods,
+		orderByMod(sort, search),
 		qm.Limit(limit),
 		qm.Offset(offset),
 	)
@@ -70,6 +213,187 @@ func (dao *employeesDAO) GetAll(exec boil.Executor, minSalary null.Float64, maxS
 	return &employeeSlice, nil
 }
 
+// GetAfter returns up to limit employees whose salary is within the range, that match search and
+// that come after the employee after in order of sort and then of ID, or the first ones if after
+// is nil. Unlike an offset, this does not get slower deeper into the list, nor skip or repeat
+// employees when others are added or deleted in between pages.
+func (dao *employeesDAO) GetAfter(exec boil.Executor, minSalary null.Float64, maxSalary null.Float64, search string, sort []domains.SortKey, after *models.Employee, limit int) (models.EmployeeSlice, error) {
+	queryMods := filterMods(minSalary, maxSalary, search)
+
+	if after != nil {
+		queryMods = append(queryMods, afterMod(sort, search, after))
+	}
+
+	queryMods = append(queryMods,
+		orderByMod(sort, search),
+		qm.Limit(limit),
+	)
+
+	employees, err := models.Employees(queryMods...).All(exec)
+	if err != nil {
+		return nil, err
+	}
+	return employees, nil
+}
+
+// rankKey is the key employees found by a search are sorted by when no sort is given, ranking
+// them by how well they match.
+const rankKey = "rank"
+
+// collatedParam compares a parameter with the collation of the employees table, as a column would
+// be, rather than with the collation of the connection.
+const collatedParam = "CONVERT(? USING utf8mb4) COLLATE utf8mb4_general_ci"
+
+// sortKeys returns the keys employees are ordered by: those of sort up to the ID, or the rank of
+// a search or else the ID without sort, adding the ID in the direction of the last key if it is
+// not one of them. Employees that sort the same on the other keys, e.g. with the same salary, then
+// always come in the same order and pages never overlap. Keys after the ID are dropped, as IDs are
+// unique.
+func sortKeys(sort []domains.SortKey, search string) []domains.SortKey {
+	if len(sort) == 0 && search != "" {
+		sort = []domains.SortKey{{Column: rankKey}}
+	}
+	keys := make([]domains.SortKey, 0, len(sort)+1)
+	for _, key := range sort {
+		keys = append(keys, key)
+		if key.Column == models.EmployeeColumns.ID {
+			return keys
+		}
+	}
+	desc := len(keys) > 0 && keys[len(keys)-1].Desc
+	return append(keys, domains.SortKey{Column: models.EmployeeColumns.ID, Desc: desc})
+}
+
+func orderByMod(sort []domains.SortKey, search string) qm.QueryMod {
+	var orderBy []string
+	var args []interface{}
+	for _, key := range sortKeys(sort, search) {
+		expr, exprArgs := sortExpr(key.Column, search, nil)
+		if key.Desc {
+			orderBy = append(orderBy, expr+" desc")
+		} else {
+			orderBy = append(orderBy, expr+" asc")
+		}
+		args = append(args, exprArgs...)
+	}
+	return qm.OrderBy(strings.Join(orderBy, ", "), args...)
+}
+
+// afterMod matches the employees that come after the employee after in order of sort, comparing
+// the keys in turn: (a > ? OR (a = ? AND (b < ? OR (b = ? AND id > ?)))) for +a,-b.
+func afterMod(sort []domains.SortKey, search string, after *models.Employee) qm.QueryMod {
+	keys := sortKeys(sort, search)
+	var where string
+	var args []interface{}
+	for i := len(keys) - 1; i >= 0; i-- {
+		op := ">"
+		if keys[i].Desc {
+			op = "<"
+		}
+		expr, exprArgs := sortExpr(keys[i].Column, search, nil)
+		value, valueArgs := sortExpr(keys[i].Column, search, after)
+		if where == "" {
+			where = fmt.Sprintf("%v %v %v", expr, op, value)
+			args = append(exprArgs, valueArgs...)
+			continue
+		}
+		where = fmt.Sprintf("(%[1]v %[2]v %[3]v OR (%[1]v = %[3]v AND %[4]v))", expr, op, value, where)
+		keyArgs := append(append([]interface{}{}, exprArgs...), valueArgs...)
+		args = append(append(keyArgs, keyArgs...), args...)
+	}
+	return qm.Where(where, args...)
+}
+
+// sortExpr returns the SQL for a sort key of the employees being compared, or of the employee
+// after if it is not nil.
+func sortExpr(column string, search string, after *models.Employee) (string, []interface{}) {
+	if column == rankKey {
+		if after == nil {
+			return rankExpr("`name`", nil, "`login`", nil, search)
+		}
+		return rankExpr(collatedParam, []interface{}{after.Name}, collatedParam, []interface{}{after.Login}, search)
+	}
+	if after == nil {
+		return "`" + column + "`", nil
+	}
+	return "?", []interface{}{sortValue(after, column)}
+}
+
+// rankExpr ranks how well a name and login match a search, from 0 if either is the search, 1 if
+// either starts with it and 2 if a later word of the name does, to 3 if either merely contains it.
+func rankExpr(name string, nameArgs []interface{}, login string, loginArgs []interface{}, search string) (string, []interface{}) {
+	prefix := escapeLike(search) + "%"
+	wordPrefix := "% " + prefix
+	expr := fmt.Sprintf("CASE WHEN %[1]v = ? OR %[2]v = ? THEN 0 WHEN %[1]v LIKE ? OR %[2]v LIKE ? THEN 1 WHEN %[1]v LIKE ? THEN 2 ELSE 3 END", name, login)
+	var args []interface{}
+	compare := func(operandArgs []interface{}, value string) {
+		args = append(append(args, operandArgs...), value)
+	}
+	compare(nameArgs, search)
+	compare(loginArgs, search)
+	compare(nameArgs, prefix)
+	compare(loginArgs, prefix)
+	compare(nameArgs, wordPrefix)
+	return expr, args
+}
+
+func sortValue(employee *models.Employee, column string) interface{} {
+	switch column {
+	case models.EmployeeColumns.Login:
+		return employee.Login
+	case models.EmployeeColumns.Name:
+		return employee.Name
+	case models.EmployeeColumns.Salary:
+		return employee.Salary
+	default:
+		return employee.ID
+	}
+}
+
+// GetAllIDsForUpdate returns the ID of every employee, in order, locking every employee until the
+// end of the transaction, and keeping new ones from being added, so the IDs stay the only ones.
+func (dao *employeesDAO) GetAllIDsForUpdate(exec boil.Executor) ([]string, error) {
+	employees, err := models.Employees(qm.Select(models.EmployeeColumns.ID), qm.OrderBy(models.EmployeeColumns.ID), qm.For("UPDATE")).All(exec)
+	if err != nil {
+		return nil, err
+	}
+	empIDs := make([]string, len(employees))
+	for i, employee := range employees {
+		empIDs[i] = employee.ID
+	}
+	return empIDs, nil
+}
+
+// filterMods matches the employees whose salary is within the range and, unless search is
+// empty, whose name or login contains search.
+func filterMods(minSalary null.Float64, maxSalary null.Float64, search string) []qm.QueryMod {
+	queryMods := salaryRangeMods(minSalary, maxSalary)
+	if search != "" {
+		// compared with the collation of the columns, which ignores case and accents
+		pattern := "%" + escapeLike(search) + "%"
+		queryMods = append(queryMods, qm.Where("(`name` LIKE ? OR `login` LIKE ?)", pattern, pattern))
+	}
+	return queryMods
+}
+
+// escapeLike escapes the wildcards of LIKE, so that s only matches itself.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func salaryRangeMods(minSalary null.Float64, maxSalary null.Float64) []qm.QueryMod {
+	var queryMods []qm.QueryMod
+
+	if !minSalary.IsZero() {
+		queryMods = append(queryMods, models.EmployeeWhere.Salary.GTE(minSalary))
+	}
+
+	if !maxSalary.IsZero() {
+		queryMods = append(queryMods, models.EmployeeWhere.Salary.LTE(maxSalary))
+	}
+	return queryMods
+}
+
 func (dao *employeesDAO) GetByID(exec boil.Executor, empID string) (*models.Employee, error) {
 	employee, err := models.Employees(models.EmployeeWhere.ID.EQ(empID)).One(exec)
 	if err != nil {
@@ -78,6 +402,50 @@ func (dao *employeesDAO) GetByID(exec boil.Executor, empID string) (*models.Empl
 	return employee, nil
 }
 
+// GetByIDsForUpdate returns the employees that exist out of empIDs, querying them in chunks to
+// keep the IN clause a reasonable size. The employees found are locked until the end of the
+// transaction so they cannot change between being read and written.
+func (dao *employeesDAO) GetByIDsForUpdate(exec boil.Executor, empIDs []string) (models.EmployeeSlice, error) {
+	return getIn(exec, models.EmployeeWhere.ID.IN, empIDs, qm.For("UPDATE"))
+}
+
+// GetByLoginsForUpdate returns the employees that hold any of logins, locking them, and the logins
+// that are free, until the end of the transaction.
+func (dao *employeesDAO) GetByLoginsForUpdate(exec boil.Executor, logins []string) (models.EmployeeSlice, error) {
+	return getIn(exec, models.EmployeeWhere.Login.IN, logins, qm.For("UPDATE"))
+}
+
+// getIn returns the employees matched by in for any of values, in chunks of values.
+func getIn(exec boil.Executor, in func([]string) qm.QueryMod, values []string, queryMods ...qm.QueryMod) (models.EmployeeSlice, error) {
+	var employees models.EmployeeSlice
+	err := eachChunk(len(values), maxInListSize, func(start int, end int) error {
+		chunk, err := models.Employees(append([]qm.QueryMod{in(values[start:end])}, queryMods...)...).All(exec)
+		employees = append(employees, chunk...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return employees, nil
+}
+
+// ReleaseLogins moves the given employees to a placeholder login derived from their ID, freeing
+// their current login for another employee within the same transaction. It is used to apply
+// login swaps, which would otherwise violate the unique login key part way through. The
+// placeholder starts with a NUL character, which real logins may not contain.
+func (dao *employeesDAO) ReleaseLogins(exec boil.Executor, empIDs []string) error {
+	return eachChunk(len(empIDs), maxInListSize, func(start int, end int) error {
+		chunk := empIDs[start:end]
+		args := make([]interface{}, len(chunk))
+		for i, empID := range chunk {
+			args[i] = empID
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunk)), ",")
+		_, err := queries.Raw("UPDATE `employees` SET `login` = CONCAT(CHAR(0 USING utf8mb4), `id`) WHERE `id` IN ("+placeholders+")", args...).Exec(exec)
+		return err
+	})
+}
+
 func (dao *employeesDAO) UpdateEmployee(exec boil.Executor, employee domains.EmployeeReqResp, empID string) error {
 	employeeInDB, err := dao.GetByID(exec, empID)
 	if err != nil {
@@ -102,3 +470,60 @@ func (dao *employeesDAO) UpsertEmployee(exec boil.Executor, employee models.Empl
 	}
 	return nil
 }
+
+// InsertEmployees inserts new employees using multi-row statements of up to batchSize rows. An
+// employee whose ID or login already exists fails with a duplicate key error.
+func (dao *employeesDAO) InsertEmployees(exec boil.Executor, employees []models.Employee, batchSize int) error {
+	return eachChunk(len(employees), batchRows(batchSize), func(start int, end int) error {
+		batch := employees[start:end]
+		query := strings.Builder{}
+		query.WriteString("INSERT INTO `employees` (`id`,`login`,`name`,`salary`) VALUES ")
+		args := make([]interface{}, 0, len(batch)*4)
+		for i, employee := range batch {
+			if i > 0 {
+				query.WriteByte(',')
+			}
+			query.WriteString("(?,?,?,?)")
+			args = append(args, employee.ID, employee.Login, employee.Name, employee.Salary)
+		}
+
+		if _, err := queries.Raw(query.String(), args...).Exec(exec); err != nil {
+			return errors.New(fmt.Sprintf("Error writing employees %v to %v: %v", batch[0].ID, batch[len(batch)-1].ID, err))
+		}
+		return nil
+	})
+}
+
+// UpdateEmployees updates existing employees using multi-row statements of up to batchSize rows,
+// joining the employees table with the new values. Employees whose ID does not exist are left out.
+func (dao *employeesDAO) UpdateEmployees(exec boil.Executor, employees []models.Employee, batchSize int) error {
+	return eachChunk(len(employees), batchRows(batchSize), func(start int, end int) error {
+		batch := employees[start:end]
+		query := strings.Builder{}
+		query.WriteString("UPDATE `employees` AS e JOIN (")
+		args := make([]interface{}, 0, len(batch)*4)
+		for i, employee := range batch {
+			if i == 0 {
+				query.WriteString("SELECT " + collatedParam + " AS `id`, ? AS `login`, ? AS `name`, ? AS `salary`")
+			} else {
+				query.WriteString(" UNION ALL SELECT " + collatedParam + ",?,?,?")
+			}
+			args = append(args, employee.ID, employee.Login, employee.Name, employee.Salary)
+		}
+		query.WriteString(") AS v ON e.`id` = v.`id` SET e.`login` = v.`login`, e.`name` = v.`name`, e.`salary` = v.`salary`")
+
+		if _, err := queries.Raw(query.String(), args...).Exec(exec); err != nil {
+			return errors.New(fmt.Sprintf("Error updating employees %v to %v: %v", batch[0].ID, batch[len(batch)-1].ID, err))
+		}
+		return nil
+	})
+}
+
+// batchRows returns the number of rows to write per statement: batchSize, unless it is not set or
+// larger than maxBatchSize.
+func batchRows(batchSize int) int {
+	if batchSize <= 0 || batchSize > maxBatchSize {
+		return maxBatchSize
+	}
+	return batchSize
+}
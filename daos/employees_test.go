@@ -0,0 +1,329 @@
+package daos
+
+import (
+	"awesomeProject/domains"
+	"awesomeProject/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+)
+
+// latencyExecutor stands in for the remote database, charging a fixed round trip for every
+// statement so the benchmarks compare the cost of round trips rather than of MySQL itself. The
+// rows/s they report follow from the number of statements alone, not from how fast MySQL writes
+// rows, which only a benchmark against a real database can tell.
+type latencyExecutor struct {
+	roundTrip  time.Duration
+	statements int
+	record     bool // whether to keep the queries, which benchmarks leave off
+	queries    []string
+}
+
+func (e *latencyExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	e.statements++
+	if e.record {
+		e.queries = append(e.queries, query)
+	}
+	time.Sleep(e.roundTrip)
+	return latencyResult{}, nil
+}
+
+// Query fails, as no rows can be returned, after recording the query.
+func (e *latencyExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if e.record {
+		e.queries = append(e.queries, query)
+	}
+	return nil, fmt.Errorf("unexpected query: %v", query)
+}
+
+func (e *latencyExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
+	panic(fmt.Sprintf("unexpected query: %v", query))
+}
+
+type latencyResult struct{}
+
+func (latencyResult) LastInsertId() (int64, error) { return 0, nil }
+func (latencyResult) RowsAffected() (int64, error) { return 1, nil }
+
+const (
+	benchmarkRows      = 5000
+	benchmarkRoundTrip = 200 * time.Microsecond
+)
+
+func benchmarkEmployees() []models.Employee {
+	employees := make([]models.Employee, benchmarkRows)
+	for i := range employees {
+		employees[i] = models.Employee{
+			ID:     fmt.Sprintf("e%05d", i),
+			Login:  fmt.Sprintf("login%05d", i),
+			Name:   fmt.Sprintf("Employee %05d", i),
+			Salary: null.Float64From(float64(i) * 10.5),
+		}
+	}
+	return employees
+}
+
+func BenchmarkUpsertEmployee(b *testing.B) {
+	dao := NewEmployeesDAO()
+	employees := benchmarkEmployees()
+	exec := &latencyExecutor{roundTrip: benchmarkRoundTrip}
+
+	b.ResetTimer()
+	start := time.Now()
+	for n := 0; n < b.N; n++ {
+		for _, employee := range employees {
+			if err := dao.UpsertEmployee(exec, employee); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(benchmarkRows*b.N)/time.Since(start).Seconds(), "rows/s")
+	b.ReportMetric(float64(exec.statements)/float64(b.N), "statements/op")
+}
+
+func BenchmarkInsertEmployees(b *testing.B) {
+	for _, batchSize := range []int{100, 500, 2000} {
+		b.Run(fmt.Sprintf("batch=%v", batchSize), func(b *testing.B) {
+			dao := NewEmployeesDAO()
+			employees := benchmarkEmployees()
+			exec := &latencyExecutor{roundTrip: benchmarkRoundTrip}
+
+			b.ResetTimer()
+			start := time.Now()
+			for n := 0; n < b.N; n++ {
+				if err := dao.InsertEmployees(exec, employees, batchSize); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(benchmarkRows*b.N)/time.Since(start).Seconds(), "rows/s")
+			b.ReportMetric(float64(exec.statements)/float64(b.N), "statements/op")
+		})
+	}
+}
+
+func TestCollationKey(t *testing.T) {
+	if len(generalCIFoldTable) != 0x180-0xC0 {
+		t.Fatalf("generalCIFoldTable has %v letters, want %v", len(generalCIFoldTable), 0x180-0xC0)
+	}
+
+	same := [][]string{
+		{"hpotter", "HPotter", "hpotter  "},
+		{"josé", "jose", "JOSÉ", "Josè"},
+		{"zoë", "zoe", "ZOË"},
+		{"straße", "strase"},
+		{"łukasz", "Łukasz"},
+		{"çağrı", "cagri"},
+		{"ÿves", "Yves", "Ÿves"},
+		{"😀", "😃"},
+	}
+	for _, values := range same {
+		for _, value := range values[1:] {
+			if CollationKey(value) != CollationKey(values[0]) {
+				t.Errorf("CollationKey(%q) = %q, want %q as for %q", value, CollationKey(value), CollationKey(values[0]), values[0])
+			}
+		}
+	}
+
+	different := [][2]string{
+		{"hpotter", " hpotter"},
+		{"straße", "strasse"},
+		{"łukasz", "lukasz"},
+		{"æsir", "aesir"},
+		{"øyvind", "oyvind"},
+		{"a×b", "axb"},
+	}
+	for _, values := range different {
+		if CollationKey(values[0]) == CollationKey(values[1]) {
+			t.Errorf("CollationKey(%q) = CollationKey(%q) = %q, want them to differ", values[0], values[1], CollationKey(values[0]))
+		}
+	}
+}
+
+func TestEachChunk(t *testing.T) {
+	tests := []struct {
+		n    int
+		size int
+		want [][2]int
+	}{
+		{n: 0, size: 3},
+		{n: 2, size: 3, want: [][2]int{{0, 2}}},
+		{n: 3, size: 3, want: [][2]int{{0, 3}}},
+		{n: 7, size: 3, want: [][2]int{{0, 3}, {3, 6}, {6, 7}}},
+	}
+	for _, test := range tests {
+		var got [][2]int
+		err := eachChunk(test.n, test.size, func(start int, end int) error {
+			got = append(got, [2]int{start, end})
+			return nil
+		})
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("eachChunk(%v, %v) = %v, %v, want %v", test.n, test.size, got, err, test.want)
+		}
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := eachChunk(7, 3, func(start int, end int) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Errorf("eachChunk() stopped after %v calls with %v, want 1 call and %v", calls, err, errStop)
+	}
+}
+
+// TestWriteEmployeesNeverUpsert checks that writing employees never updates on a duplicate key, as
+// a duplicate login would then overwrite the employee holding it.
+func TestWriteEmployeesNeverUpsert(t *testing.T) {
+	dao := NewEmployeesDAO()
+	employees := benchmarkEmployees()[:5]
+	exec := &latencyExecutor{record: true}
+	if err := dao.InsertEmployees(exec, employees, 2); err != nil {
+		t.Fatalf("InsertEmployees() returned error %v", err)
+	}
+	if err := dao.UpdateEmployees(exec, employees, 2); err != nil {
+		t.Fatalf("UpdateEmployees() returned error %v", err)
+	}
+	if exec.statements != 6 {
+		t.Errorf("wrote 5 employees in batches of 2 with %v statements, want 6", exec.statements)
+	}
+	for _, query := range exec.queries {
+		if strings.Contains(strings.ToUpper(query), "ON DUPLICATE KEY") {
+			t.Errorf("wrote employees with %q", query)
+		}
+	}
+}
+
+func TestSortKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   []domains.SortKey
+		search string
+		want   []domains.SortKey
+	}{
+		{"no sort", nil, "", []domains.SortKey{{Column: "id"}}},
+		{"search without sort", nil, "ha", []domains.SortKey{{Column: rankKey}, {Column: "id"}}},
+		{"search with sort", []domains.SortKey{{Column: "name"}}, "ha", []domains.SortKey{{Column: "name"}, {Column: "id"}}},
+		{"descending", []domains.SortKey{{Column: "salary", Desc: true}}, "", []domains.SortKey{{Column: "salary", Desc: true}, {Column: "id", Desc: true}}},
+		{"ID in the direction of the last key",
+			[]domains.SortKey{{Column: "salary"}, {Column: "name", Desc: true}}, "",
+			[]domains.SortKey{{Column: "salary"}, {Column: "name", Desc: true}, {Column: "id", Desc: true}}},
+		{"keys after the ID", []domains.SortKey{{Column: "id", Desc: true}, {Column: "name"}}, "", []domains.SortKey{{Column: "id", Desc: true}}},
+		{"ID in between", []domains.SortKey{{Column: "login"}, {Column: "id"}, {Column: "name"}}, "", []domains.SortKey{{Column: "login"}, {Column: "id"}}},
+	}
+	for _, test := range tests {
+		if got := sortKeys(test.sort, test.search); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("sortKeys(%v) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAfterMod(t *testing.T) {
+	after := &models.Employee{ID: "e0002", Login: "rwesley", Name: "Ron Weasley", Salary: null.Float64From(1234)}
+	salary := null.Float64From(1234)
+	tests := []struct {
+		name  string
+		sort  []domains.SortKey
+		where string
+		args  []interface{}
+	}{
+		{"no sort", nil, "`id` > ?", []interface{}{"e0002"}},
+		{"descending ID", []domains.SortKey{{Column: "id", Desc: true}}, "`id` < ?", []interface{}{"e0002"}},
+		{"one key", []domains.SortKey{{Column: "salary"}},
+			"(`salary` > ? OR (`salary` = ? AND `id` > ?))",
+			[]interface{}{salary, salary, "e0002"}},
+		{"several keys", []domains.SortKey{{Column: "salary"}, {Column: "name", Desc: true}},
+			"(`salary` > ? OR (`salary` = ? AND (`name` < ? OR (`name` = ? AND `id` < ?))))",
+			[]interface{}{salary, salary, "Ron Weasley", "Ron Weasley", "e0002"}},
+		{"login", []domains.SortKey{{Column: "login", Desc: true}},
+			"(`login` < ? OR (`login` = ? AND `id` < ?))",
+			[]interface{}{"rwesley", "rwesley", "e0002"}},
+	}
+	for _, test := range tests {
+		query, args := queries.BuildQuery(models.Employees(afterMod(test.sort, "", after)).Query)
+		want := "SELECT `employees`.* FROM `employees` WHERE (" + test.where + ");"
+		if query != want || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("afterMod(%v) built %v %v, want %v %v", test.name, query, args, want, test.args)
+		}
+	}
+}
+
+// TestAfterModSearch checks that a search without sort compares the rank of the employees with
+// that of the employee after, computed from its name and login, and then the ID.
+func TestAfterModSearch(t *testing.T) {
+	after := &models.Employee{ID: "e0002", Login: "rwesley", Name: "Ron Weasley"}
+	query, args := queries.BuildQuery(models.Employees(afterMod(nil, "we", after)).Query)
+
+	column, columnArgs := rankExpr("`name`", nil, "`login`", nil, "we")
+	value, valueArgs := rankExpr(collatedParam, []interface{}{"Ron Weasley"}, collatedParam, []interface{}{"rwesley"}, "we")
+	want := fmt.Sprintf("SELECT `employees`.* FROM `employees` WHERE ((%[1]v > %[2]v OR (%[1]v = %[2]v AND `id` > ?)));", column, value)
+	if query != want {
+		t.Errorf("afterMod() built %v, want %v", query, want)
+	}
+	rankArgs := append(append([]interface{}{}, columnArgs...), valueArgs...)
+	wantArgs := append(append(append([]interface{}{}, rankArgs...), rankArgs...), "e0002")
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("afterMod() built args %v, want %v", args, wantArgs)
+	}
+	if placeholders := strings.Count(query, "?"); placeholders != len(args) {
+		t.Errorf("afterMod() built %v placeholders for %v args", placeholders, len(args))
+	}
+}
+
+func TestRankExpr(t *testing.T) {
+	expr, args := rankExpr("`name`", nil, "`login`", nil, "50%_off")
+	want := "CASE WHEN `name` = ? OR `login` = ? THEN 0 WHEN `name` LIKE ? OR `login` LIKE ? THEN 1 WHEN `name` LIKE ? THEN 2 ELSE 3 END"
+	wantArgs := []interface{}{"50%_off", "50%_off", `50\%\_off%`, `50\%\_off%`, `% 50\%\_off%`}
+	if expr != want || !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("rankExpr() = %v %v, want %v %v", expr, args, want, wantArgs)
+	}
+}
+
+// TestReadsForUpdate checks that the reads of employees about to be written lock them.
+func TestReadsForUpdate(t *testing.T) {
+	dao := NewEmployeesDAO()
+	exec := &latencyExecutor{record: true}
+	dao.GetAllIDsForUpdate(exec)
+	dao.GetByIDsForUpdate(exec, []string{"e0001"})
+	dao.GetByLoginsForUpdate(exec, []string{"hpotter"})
+	if len(exec.queries) != 3 {
+		t.Fatalf("read employees with %v queries, want 3", len(exec.queries))
+	}
+	for _, query := range exec.queries {
+		if !strings.HasSuffix(strings.TrimRight(query, ";"), "FOR UPDATE") {
+			t.Errorf("read employees with %q, want a locking read", query)
+		}
+	}
+}
+
+func TestResolvePolicy(t *testing.T) {
+	tests := []struct {
+		policy     string
+		exists     bool
+		wantAction PolicyAction
+		wantErr    error
+	}{
+		{domains.PolicyUpsert, false, PolicyWrite, nil},
+		{domains.PolicyUpsert, true, PolicyWrite, nil},
+		{domains.PolicyInsertOnly, false, PolicyWrite, nil},
+		{domains.PolicyInsertOnly, true, PolicyNone, ErrEmployeeExists},
+		{domains.PolicyUpdateOnly, false, PolicyNone, ErrEmployeeNotFound},
+		{domains.PolicyUpdateOnly, true, PolicyWrite, nil},
+		{domains.PolicySkipExisting, false, PolicyWrite, nil},
+		{domains.PolicySkipExisting, true, PolicySkip, nil},
+	}
+	dao := NewEmployeesDAO()
+	for _, test := range tests {
+		action, err := dao.ResolvePolicy(test.policy, test.exists)
+		if action != test.wantAction || err != test.wantErr {
+			t.Errorf("ResolvePolicy(%v, exists %v) = %v, %v, want %v, %v", test.policy, test.exists, action, err, test.wantAction, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package daos
+
+import (
+	"awesomeProject/domains"
+	"encoding/json"
+	"time"
+
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+)
+
+type UploadJobsDAO interface {
+	AddUploadJob(exec boil.Executor, job domains.UploadJob) error
+	GetByID(exec boil.Executor, jobID string) (*domains.UploadJob, error)
+	GetNextQueued(exec boil.Executor) (*domains.UploadJob, error)
+	RequeueRunning(exec boil.Executor) error
+	SaveFileDetails(exec boil.Executor, jobID string, fileIndex int, file domains.UploadFile) error
+	UpdateUploadJob(exec boil.Executor, job domains.UploadJob) error
+}
+
+// uploadJob is the upload_jobs row. Options and files are stored as JSON, without the diff and
+// row errors of the files, which are stored in upload_job_details.
+type uploadJob struct {
+	ID            string      `boil:"id"`
+	State         string      `boil:"state"`
+	Uploader      string      `boil:"uploader"`
+	UploaderIP    string      `boil:"uploader_ip"`
+	Options       string      `boil:"options"`
+	Files         string      `boil:"files"`
+	RowsProcessed int         `boil:"rows_processed"`
+	RowsFailed    int         `boil:"rows_failed"`
+	Error         null.String `boil:"error"`
+	CreatedAt     time.Time   `boil:"created_at"`
+	StartedAt     null.Time   `boil:"started_at"`
+	FinishedAt    null.Time   `boil:"finished_at"`
+}
+
+// uploadJobDetail is an upload_job_details row, holding a chunk of the diff and row errors of a
+// file as JSON.
+type uploadJobDetail struct {
+	FileIndex int    `boil:"file_index"`
+	Content   string `boil:"content"`
+}
+
+// fileDetails is a chunk of the diff and row errors of a file.
+type fileDetails struct {
+	Diff   *domains.EmployeeDiff `json:"diff,omitempty"`
+	Errors []domains.RowError    `json:"errors,omitempty"`
+}
+
+// jobDetailsChunkSize is the most diff entries and row errors stored per upload_job_details row.
+// A file can have one of each per row, too many to rewrite with the job after every file or to
+// write with a single statement.
+const jobDetailsChunkSize = 1000
+
+const uploadJobColumns = "`id`, `state`, `uploader`, `uploader_ip`, `options`, `files`, `rows_processed`, `rows_failed`, `error`, `created_at`, `started_at`, `finished_at`"
+
+type uploadJobsDAO struct{}
+
+func NewUploadJobsDAO() *uploadJobsDAO {
+	return &uploadJobsDAO{}
+}
+
+func (dao *uploadJobsDAO) AddUploadJob(exec boil.Executor, job domains.UploadJob) error {
+	row, err := toUploadJobRow(job)
+	if err != nil {
+		return err
+	}
+	_, err = queries.Raw("INSERT INTO `upload_jobs` ("+uploadJobColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		row.ID, row.State, row.Uploader, row.UploaderIP, row.Options, row.Files, row.RowsProcessed, row.RowsFailed, row.Error, row.CreatedAt, row.StartedAt, row.FinishedAt,
+	).Exec(exec)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (dao *uploadJobsDAO) GetByID(exec boil.Executor, jobID string) (*domains.UploadJob, error) {
+	var row uploadJob
+	err := queries.Raw("SELECT "+uploadJobColumns+" FROM `upload_jobs` WHERE `id` = ?", jobID).Bind(nil, exec, &row)
+	if err != nil {
+		return nil, err
+	}
+	return dao.fromUploadJobRow(exec, row)
+}
+
+// GetNextQueued returns the oldest queued job, or sql.ErrNoRows when the queue is empty.
+func (dao *uploadJobsDAO) GetNextQueued(exec boil.Executor) (*domains.UploadJob, error) {
+	var row uploadJob
+	err := queries.Raw("SELECT "+uploadJobColumns+" FROM `upload_jobs` WHERE `state` = ? ORDER BY `created_at`, `id` LIMIT 1", domains.UploadJobQueued).Bind(nil, exec, &row)
+	if err != nil {
+		return nil, err
+	}
+	return dao.fromUploadJobRow(exec, row)
+}
+
+// RequeueRunning puts jobs that were interrupted by a restart back in the queue. Their open
+// transaction was rolled back, so the file that was being processed is run again.
+func (dao *uploadJobsDAO) RequeueRunning(exec boil.Executor) error {
+	_, err := queries.Raw("UPDATE `upload_jobs` SET `state` = ? WHERE `state` = ?", domains.UploadJobQueued, domains.UploadJobRunning).Exec(exec)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SaveFileDetails stores the diff and row errors of a file of a job, replacing those stored
+// before, e.g. by a run interrupted by a restart. They are returned with the job but not written
+// by UpdateUploadJob, so they are only written once per file.
+func (dao *uploadJobsDAO) SaveFileDetails(exec boil.Executor, jobID string, fileIndex int, file domains.UploadFile) error {
+	_, err := queries.Raw("DELETE FROM `upload_job_details` WHERE `job_id` = ? AND `file_index` = ?", jobID, fileIndex).Exec(exec)
+	if err != nil {
+		return err
+	}
+	for chunk, details := range chunkFileDetails(file.Diff, file.Errors) {
+		content, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		_, err = queries.Raw("INSERT INTO `upload_job_details` (`job_id`, `file_index`, `chunk`, `content`) VALUES (?, ?, ?, ?)",
+			jobID, fileIndex, chunk, string(content),
+		).Exec(exec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkFileDetails splits a diff and row errors into chunks of up to jobDetailsChunkSize entries.
+// A diff without entries still takes a chunk, so that it is returned as an empty diff.
+func chunkFileDetails(diff *domains.EmployeeDiff, rowErrors []domains.RowError) []fileDetails {
+	var chunks []fileDetails
+	entries := jobDetailsChunkSize
+	next := func() *fileDetails {
+		if entries == jobDetailsChunkSize {
+			chunks = append(chunks, fileDetails{})
+			entries = 0
+		}
+		entries++
+		return &chunks[len(chunks)-1]
+	}
+	nextDiff := func() *domains.EmployeeDiff {
+		details := next()
+		if details.Diff == nil {
+			details.Diff = &domains.EmployeeDiff{}
+		}
+		return details.Diff
+	}
+
+	if diff != nil {
+		chunks = append(chunks, fileDetails{Diff: &domains.EmployeeDiff{}})
+		entries = 0
+		for _, empID := range diff.Inserted {
+			d := nextDiff()
+			d.Inserted = append(d.Inserted, empID)
+		}
+		for _, change := range diff.Updated {
+			d := nextDiff()
+			d.Updated = append(d.Updated, change)
+		}
+		for _, empID := range diff.Unchanged {
+			d := nextDiff()
+			d.Unchanged = append(d.Unchanged, empID)
+		}
+		for _, empID := range diff.Skipped {
+			d := nextDiff()
+			d.Skipped = append(d.Skipped, empID)
+		}
+		for _, empID := range diff.Deleted {
+			d := nextDiff()
+			d.Deleted = append(d.Deleted, empID)
+		}
+	}
+	for _, rowError := range rowErrors {
+		details := next()
+		details.Errors = append(details.Errors, rowError)
+	}
+	return chunks
+}
+
+// addFileDetails adds the diff and row errors stored by SaveFileDetails to the files of a job.
+func (dao *uploadJobsDAO) addFileDetails(exec boil.Executor, job *domains.UploadJob) error {
+	var rows []uploadJobDetail
+	err := queries.Raw("SELECT `file_index`, `content` FROM `upload_job_details` WHERE `job_id` = ? ORDER BY `file_index`, `chunk`", job.ID).Bind(nil, exec, &rows)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row.FileIndex < 0 || row.FileIndex >= len(job.Files) {
+			continue
+		}
+		var details fileDetails
+		if err := json.Unmarshal([]byte(row.Content), &details); err != nil {
+			return err
+		}
+		file := &job.Files[row.FileIndex]
+		if details.Diff != nil {
+			if file.Diff == nil {
+				file.Diff = &domains.EmployeeDiff{
+					Inserted:  []string{},
+					Updated:   []domains.EmployeeChange{},
+					Unchanged: []string{},
+					Skipped:   []string{},
+					Deleted:   []string{},
+				}
+			}
+			file.Diff.Inserted = append(file.Diff.Inserted, details.Diff.Inserted...)
+			file.Diff.Updated = append(file.Diff.Updated, details.Diff.Updated...)
+			file.Diff.Unchanged = append(file.Diff.Unchanged, details.Diff.Unchanged...)
+			file.Diff.Skipped = append(file.Diff.Skipped, details.Diff.Skipped...)
+			file.Diff.Deleted = append(file.Diff.Deleted, details.Diff.Deleted...)
+		}
+		file.Errors = append(file.Errors, details.Errors...)
+	}
+	return nil
+}
+
+func (dao *uploadJobsDAO) UpdateUploadJob(exec boil.Executor, job domains.UploadJob) error {
+	row, err := toUploadJobRow(job)
+	if err != nil {
+		return err
+	}
+	_, err = queries.Raw("UPDATE `upload_jobs` SET `state` = ?, `options` = ?, `files` = ?, `rows_processed` = ?, `rows_failed` = ?, `error` = ?, `started_at` = ?, `finished_at` = ? WHERE `id` = ?",
+		row.State, row.Options, row.Files, row.RowsProcessed, row.RowsFailed, row.Error, row.StartedAt, row.FinishedAt, row.ID,
+	).Exec(exec)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func toUploadJobRow(job domains.UploadJob) (uploadJob, error) {
+	options, err := json.Marshal(job.Options)
+	if err != nil {
+		return uploadJob{}, err
+	}
+	// the diff and row errors are written once per file by SaveFileDetails
+	summaries := make([]domains.UploadFile, len(job.Files))
+	for i, file := range job.Files {
+		file.Diff = nil
+		file.Errors = nil
+		summaries[i] = file
+	}
+	files, err := json.Marshal(summaries)
+	if err != nil {
+		return uploadJob{}, err
+	}
+	return uploadJob{
+		ID:            job.ID,
+		State:         job.State,
+		Uploader:      job.Uploader,
+		UploaderIP:    job.UploaderIP,
+		Options:       string(options),
+		Files:         string(files),
+		RowsProcessed: job.RowsProcessed,
+		RowsFailed:    job.RowsFailed,
+		Error:         null.NewString(job.Error, job.Error != ""),
+		CreatedAt:     job.CreatedAt,
+		StartedAt:     null.TimeFromPtr(job.StartedAt),
+		FinishedAt:    null.TimeFromPtr(job.FinishedAt),
+	}, nil
+}
+
+func (dao *uploadJobsDAO) fromUploadJobRow(exec boil.Executor, row uploadJob) (*domains.UploadJob, error) {
+	job := &domains.UploadJob{
+		ID:            row.ID,
+		State:         row.State,
+		Uploader:      row.Uploader,
+		UploaderIP:    row.UploaderIP,
+		RowsProcessed: row.RowsProcessed,
+		RowsFailed:    row.RowsFailed,
+		Error:         row.Error.String,
+		CreatedAt:     row.CreatedAt,
+		StartedAt:     row.StartedAt.Ptr(),
+		FinishedAt:    row.FinishedAt.Ptr(),
+	}
+	if err := json.Unmarshal([]byte(row.Options), &job.Options); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(row.Files), &job.Files); err != nil {
+		return nil, err
+	}
+	if err := dao.addFileDetails(exec, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
@@ -0,0 +1,272 @@
+package daos
+
+import (
+	"awesomeProject/domains"
+	"strings"
+	"time"
+
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+)
+
+type UploadsDAO interface {
+	AddSnapshots(exec boil.Executor, uploadID int64, snapshots []domains.EmployeeSnapshot) error
+	AddRejects(exec boil.Executor, uploadID int64, rejects string) error
+	AddUpload(exec boil.Executor, upload domains.Upload) (int64, error)
+	GetAll(exec boil.Executor, limit int, offset int) ([]domains.Upload, error)
+	GetAppliedByHash(exec boil.Executor, contentHash string, optionsHash string) (*domains.Upload, error)
+	GetByID(exec boil.Executor, uploadID int64) (*domains.Upload, error)
+	GetRejects(exec boil.Executor, uploadID int64) (string, error)
+	GetSnapshots(exec boil.Executor, uploadID int64) ([]domains.EmployeeSnapshot, error)
+	MarkInterrupted(exec boil.Executor) error
+	MarkReverted(exec boil.Executor, uploadID int64, revertedAt time.Time) (bool, error)
+	UpdateUpload(exec boil.Executor, upload domains.Upload) error
+}
+
+// upload is the uploads row.
+type upload struct {
+	ID          int64       `boil:"id"`
+	JobID       string      `boil:"job_id"`
+	Filename    string      `boil:"filename"`
+	ContentHash string      `boil:"content_hash"`
+	OptionsHash string      `boil:"options_hash"`
+	Uploader    string      `boil:"uploader"`
+	UploaderIP  string      `boil:"uploader_ip"`
+	DryRun      bool        `boil:"dry_run"`
+	Outcome     string      `boil:"outcome"`
+	DuplicateOf null.Int64  `boil:"duplicate_of"`
+	Inserted    int         `boil:"inserted"`
+	Updated     int         `boil:"updated"`
+	Unchanged   int         `boil:"unchanged"`
+	Skipped     int         `boil:"skipped"`
+	Deleted     int         `boil:"deleted"`
+	Failed      int         `boil:"failed"`
+	Comments    int         `boil:"comments"`
+	Error       null.String `boil:"error"`
+	StartedAt   time.Time   `boil:"started_at"`
+	FinishedAt  null.Time   `boil:"finished_at"`
+	RevertedAt  null.Time   `boil:"reverted_at"`
+}
+
+const uploadColumns = "`id`, `job_id`, `filename`, `content_hash`, `options_hash`, `uploader`, `uploader_ip`, `dry_run`, `outcome`, `duplicate_of`, `inserted`, `updated`, `unchanged`, `skipped`, `deleted`, `failed`, `comments`, `error`, `started_at`, `finished_at`, `reverted_at`"
+
+// uploadSnapshot is the upload_snapshots row. The before columns are null for an inserted
+// employee, the after columns for a deleted one.
+type uploadSnapshot struct {
+	EmployeeID   string       `boil:"employee_id"`
+	BeforeLogin  null.String  `boil:"before_login"`
+	BeforeName   null.String  `boil:"before_name"`
+	BeforeSalary null.Float64 `boil:"before_salary"`
+	AfterLogin   null.String  `boil:"after_login"`
+	AfterName    null.String  `boil:"after_name"`
+	AfterSalary  null.Float64 `boil:"after_salary"`
+}
+
+// maxSnapshotBatchSize keeps a multi-row insert of snapshots under MySQL's limit of 65535
+// placeholders.
+const maxSnapshotBatchSize = 65535 / 8
+
+type uploadsDAO struct{}
+
+func NewUploadsDAO() *uploadsDAO {
+	return &uploadsDAO{}
+}
+
+// AddSnapshots records the state of the employees an upload changed, using multi-row inserts.
+func (dao *uploadsDAO) AddSnapshots(exec boil.Executor, uploadID int64, snapshots []domains.EmployeeSnapshot) error {
+	return eachChunk(len(snapshots), maxSnapshotBatchSize, func(start int, end int) error {
+		batch := snapshots[start:end]
+
+		query := strings.Builder{}
+		query.WriteString("INSERT INTO `upload_snapshots` (`upload_id`,`employee_id`,`before_login`,`before_name`,`before_salary`,`after_login`,`after_name`,`after_salary`) VALUES ")
+		args := make([]interface{}, 0, len(batch)*8)
+		for i, snapshot := range batch {
+			if i > 0 {
+				query.WriteByte(',')
+			}
+			query.WriteString("(?,?,?,?,?,?,?,?)")
+			row := toSnapshotRow(snapshot)
+			args = append(args, uploadID, row.EmployeeID, row.BeforeLogin, row.BeforeName, row.BeforeSalary, row.AfterLogin, row.AfterName, row.AfterSalary)
+		}
+
+		_, err := queries.Raw(query.String(), args...).Exec(exec)
+		return err
+	})
+}
+
+// AddRejects saves the CSV file of the rows a partial upload rejected.
+func (dao *uploadsDAO) AddRejects(exec boil.Executor, uploadID int64, rejects string) error {
+	_, err := queries.Raw("INSERT INTO `upload_rejects` (`upload_id`, `content`) VALUES (?, ?)", uploadID, rejects).Exec(exec)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (dao *uploadsDAO) AddUpload(exec boil.Executor, upload domains.Upload) (int64, error) {
+	result, err := queries.Raw("INSERT INTO `uploads` (`job_id`, `filename`, `content_hash`, `options_hash`, `uploader`, `uploader_ip`, `dry_run`, `outcome`, `duplicate_of`, `inserted`, `updated`, `unchanged`, `skipped`, `deleted`, `failed`, `comments`, `error`, `started_at`, `finished_at`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		upload.JobID, upload.Filename, upload.ContentHash, upload.OptionsHash, upload.Uploader, upload.UploaderIP, upload.DryRun, upload.Outcome,
+		null.NewInt64(upload.DuplicateOf, upload.DuplicateOf != 0), upload.Inserted, upload.Updated, upload.Unchanged, upload.Skipped, upload.Deleted, upload.Failed, upload.Comments,
+		null.NewString(upload.Error, upload.Error != ""), upload.StartedAt, null.TimeFromPtr(upload.FinishedAt),
+	).Exec(exec)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetAll returns the upload history, most recent first.
+func (dao *uploadsDAO) GetAll(exec boil.Executor, limit int, offset int) ([]domains.Upload, error) {
+	var rows []upload
+	err := queries.Raw("SELECT "+uploadColumns+" FROM `uploads` ORDER BY `id` DESC LIMIT ? OFFSET ?", limit, offset).Bind(nil, exec, &rows)
+	if err != nil {
+		return nil, err
+	}
+	uploads := make([]domains.Upload, 0, len(rows))
+	for _, row := range rows {
+		uploads = append(uploads, fromUploadRow(row))
+	}
+	return uploads, nil
+}
+
+// GetAppliedByHash returns the most recent upload of a file with the given content, processed
+// with the same options, that was applied and not reverted, or sql.ErrNoRows if there is none.
+func (dao *uploadsDAO) GetAppliedByHash(exec boil.Executor, contentHash string, optionsHash string) (*domains.Upload, error) {
+	var row upload
+	err := queries.Raw("SELECT "+uploadColumns+" FROM `uploads` WHERE `content_hash` = ? AND `options_hash` = ? AND `dry_run` = FALSE AND `outcome` = ? ORDER BY `id` DESC LIMIT 1", contentHash, optionsHash, domains.UploadSucceeded).Bind(nil, exec, &row)
+	if err != nil {
+		return nil, err
+	}
+	upload := fromUploadRow(row)
+	return &upload, nil
+}
+
+func (dao *uploadsDAO) GetByID(exec boil.Executor, uploadID int64) (*domains.Upload, error) {
+	var row upload
+	err := queries.Raw("SELECT "+uploadColumns+" FROM `uploads` WHERE `id` = ?", uploadID).Bind(nil, exec, &row)
+	if err != nil {
+		return nil, err
+	}
+	upload := fromUploadRow(row)
+	return &upload, nil
+}
+
+// GetSnapshots returns the snapshots of the employees an upload changed, ordered by employee ID.
+func (dao *uploadsDAO) GetSnapshots(exec boil.Executor, uploadID int64) ([]domains.EmployeeSnapshot, error) {
+	var rows []uploadSnapshot
+	err := queries.Raw("SELECT `employee_id`, `before_login`, `before_name`, `before_salary`, `after_login`, `after_name`, `after_salary` FROM `upload_snapshots` WHERE `upload_id` = ? ORDER BY `employee_id`", uploadID).Bind(nil, exec, &rows)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]domains.EmployeeSnapshot, 0, len(rows))
+	for _, row := range rows {
+		snapshots = append(snapshots, fromSnapshotRow(row))
+	}
+	return snapshots, nil
+}
+
+// GetRejects returns the CSV file of the rows an upload rejected, or sql.ErrNoRows if it rejected
+// none.
+func (dao *uploadsDAO) GetRejects(exec boil.Executor, uploadID int64) (string, error) {
+	var row struct {
+		Content string `boil:"content"`
+	}
+	err := queries.Raw("SELECT `content` FROM `upload_rejects` WHERE `upload_id` = ?", uploadID).Bind(nil, exec, &row)
+	if err != nil {
+		return "", err
+	}
+	return row.Content, nil
+}
+
+// MarkInterrupted records that uploads which were running when the service stopped never
+// finished. Their changes were rolled back.
+func (dao *uploadsDAO) MarkInterrupted(exec boil.Executor) error {
+	_, err := queries.Raw("UPDATE `uploads` SET `outcome` = ?, `finished_at` = ? WHERE `outcome` = ?",
+		domains.UploadInterrupted, time.Now().UTC(), domains.UploadRunning,
+	).Exec(exec)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkReverted marks an upload as reverted unless it already is, or it is still running or
+// failed. It reports whether the upload was marked. Within a transaction, the upload stays
+// locked until the transaction ends.
+func (dao *uploadsDAO) MarkReverted(exec boil.Executor, uploadID int64, revertedAt time.Time) (bool, error) {
+	result, err := queries.Raw("UPDATE `uploads` SET `outcome` = ?, `reverted_at` = ? WHERE `id` = ? AND `dry_run` = FALSE AND `outcome` IN (?, ?)",
+		domains.UploadReverted, revertedAt, uploadID, domains.UploadSucceeded, domains.UploadInterrupted,
+	).Exec(exec)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (dao *uploadsDAO) UpdateUpload(exec boil.Executor, upload domains.Upload) error {
+	_, err := queries.Raw("UPDATE `uploads` SET `content_hash` = ?, `outcome` = ?, `duplicate_of` = ?, `inserted` = ?, `updated` = ?, `unchanged` = ?, `skipped` = ?, `deleted` = ?, `failed` = ?, `comments` = ?, `error` = ?, `finished_at` = ? WHERE `id` = ?",
+		upload.ContentHash, upload.Outcome, null.NewInt64(upload.DuplicateOf, upload.DuplicateOf != 0), upload.Inserted, upload.Updated, upload.Unchanged, upload.Skipped, upload.Deleted, upload.Failed, upload.Comments,
+		null.NewString(upload.Error, upload.Error != ""), null.TimeFromPtr(upload.FinishedAt), upload.ID,
+	).Exec(exec)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func fromUploadRow(row upload) domains.Upload {
+	return domains.Upload{
+		ID:          row.ID,
+		JobID:       row.JobID,
+		Filename:    row.Filename,
+		ContentHash: row.ContentHash,
+		OptionsHash: row.OptionsHash,
+		Uploader:    row.Uploader,
+		UploaderIP:  row.UploaderIP,
+		DryRun:      row.DryRun,
+		Outcome:     row.Outcome,
+		DuplicateOf: row.DuplicateOf.Int64,
+		Inserted:    row.Inserted,
+		Updated:     row.Updated,
+		Unchanged:   row.Unchanged,
+		Skipped:     row.Skipped,
+		Deleted:     row.Deleted,
+		Failed:      row.Failed,
+		Comments:    row.Comments,
+		Error:       row.Error.String,
+		StartedAt:   row.StartedAt,
+		FinishedAt:  row.FinishedAt.Ptr(),
+		RevertedAt:  row.RevertedAt.Ptr(),
+	}
+}
+
+func toSnapshotRow(snapshot domains.EmployeeSnapshot) uploadSnapshot {
+	row := uploadSnapshot{EmployeeID: snapshot.EmployeeID}
+	if snapshot.Before != nil {
+		row.BeforeLogin = null.StringFrom(snapshot.Before.Login)
+		row.BeforeName = null.StringFrom(snapshot.Before.Name)
+		row.BeforeSalary = null.Float64From(snapshot.Before.Salary)
+	}
+	if snapshot.After != nil {
+		row.AfterLogin = null.StringFrom(snapshot.After.Login)
+		row.AfterName = null.StringFrom(snapshot.After.Name)
+		row.AfterSalary = null.Float64From(snapshot.After.Salary)
+	}
+	return row
+}
+
+func fromSnapshotRow(row uploadSnapshot) domains.EmployeeSnapshot {
+	snapshot := domains.EmployeeSnapshot{EmployeeID: row.EmployeeID}
+	if row.BeforeLogin.Valid {
+		snapshot.Before = &domains.EmployeeReqResp{Login: row.BeforeLogin.String, Name: row.BeforeName.String, Salary: row.BeforeSalary.Float64}
+	}
+	if row.AfterLogin.Valid {
+		snapshot.After = &domains.EmployeeReqResp{Login: row.AfterLogin.String, Name: row.AfterName.String, Salary: row.AfterSalary.Float64}
+	}
+	return snapshot
+}
@@ -0,0 +1,21 @@
+package daos
+
+import (
+	"awesomeProject/domains"
+	"fmt"
+	"testing"
+)
+
+func TestAddSnapshotsBatches(t *testing.T) {
+	snapshots := make([]domains.EmployeeSnapshot, 2*maxSnapshotBatchSize+1)
+	for i := range snapshots {
+		snapshots[i] = domains.EmployeeSnapshot{EmployeeID: fmt.Sprintf("e%05d", i), After: &domains.EmployeeReqResp{Login: fmt.Sprintf("login%05d", i)}}
+	}
+	exec := &latencyExecutor{}
+	if err := NewUploadsDAO().AddSnapshots(exec, 1, snapshots); err != nil {
+		t.Fatalf("AddSnapshots() returned error %v", err)
+	}
+	if exec.statements != 3 {
+		t.Errorf("added %v snapshots in batches of %v with %v statements, want 3", len(snapshots), maxSnapshotBatchSize, exec.statements)
+	}
+}
@@ -3,6 +3,13 @@ package domains
 type (
 	AllEmployeeResp struct {
 		Results []Employee `json:"results"`
+		Total   int64      `json:"total"` // employees matching the filters, on every page
+		Limit   int        `json:"limit"`
+		Offset  int        `json:"offset"`
+		Next    string     `json:"next,omitempty"` // link to the next page, unless this is the last
+		Prev    string     `json:"prev,omitempty"` // link to the previous page, unless this is the first
+		// NextCursor marks the end of this page, to get the next page with cursor= instead of an offset
+		NextCursor string `json:"nextCursor,omitempty"`
 	}
 
 	Employee struct {
@@ -13,8 +20,45 @@ type (
 	}
 )
 
+// SortKey is one of the columns employees are listed in order of, e.g. -salary.
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
 type EmployeeReqResp struct {
 	Name   string  `json:"name"`
 	Login  string  `json:"login"`
 	Salary float64 `json:"salary"`
 }
+
+// Conflict policies, deciding what an upload does with employees whose ID already exists.
+const (
+	PolicyUpsert       = "upsert"
+	PolicyInsertOnly   = "insertOnly"
+	PolicyUpdateOnly   = "updateOnly"
+	PolicySkipExisting = "skipExisting"
+)
+
+type RowError struct {
+	Line       int    `json:"line"`
+	EmployeeID string `json:"employeeId,omitempty"`
+	Field      string `json:"field,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+type (
+	EmployeeDiff struct {
+		Inserted  []string         `json:"inserted"`
+		Updated   []EmployeeChange `json:"updated"`
+		Unchanged []string         `json:"unchanged"`
+		Skipped   []string         `json:"skipped"` // existing employees left as they are by skipExisting
+		Deleted   []string         `json:"deleted"` // employees missing from a sync upload
+	}
+
+	EmployeeChange struct {
+		ID     string          `json:"id"`
+		Before EmployeeReqResp `json:"before"`
+		After  EmployeeReqResp `json:"after"`
+	}
+)
@@ -0,0 +1,147 @@
+package domains
+
+import (
+	"time"
+)
+
+const (
+	UploadJobQueued    = "queued"
+	UploadJobRunning   = "running"
+	UploadJobSucceeded = "succeeded"
+	UploadJobPartial   = "partial" // some files succeeded and some failed
+	UploadJobFailed    = "failed"
+)
+
+const (
+	UploadFilePending   = "pending"
+	UploadFileSucceeded = "succeeded"
+	UploadFileDuplicate = "duplicate"
+	UploadFilePartial   = "partial" // valid rows were applied and the others rejected
+	UploadFileFailed    = "failed"
+)
+
+const (
+	UploadModeAtomic  = "atomic" // a file is applied in full or not at all
+	UploadModePartial = "partial"
+	UploadModeSync    = "sync" // employees missing from the file are deleted
+)
+
+const (
+	UploadRunning     = "running"
+	UploadSucceeded   = "succeeded"
+	UploadFailed      = "failed"
+	UploadInterrupted = "interrupted"
+	UploadReverted    = "reverted"
+	UploadDuplicate   = "duplicate"
+)
+
+type (
+	UploadJob struct {
+		ID            string        `json:"id"`
+		State         string        `json:"state"`
+		Uploader      string        `json:"uploader"`
+		UploaderIP    string        `json:"uploaderIp,omitempty"` // of the client, empty for the drop folder
+		Options       UploadOptions `json:"options"`
+		Files         []UploadFile  `json:"files"`
+		RowsProcessed int           `json:"rowsProcessed"`
+		RowsFailed    int           `json:"rowsFailed"`
+		Error         string        `json:"error,omitempty"`
+		CreatedAt     time.Time     `json:"createdAt"`
+		StartedAt     *time.Time    `json:"startedAt,omitempty"`
+		FinishedAt    *time.Time    `json:"finishedAt,omitempty"`
+	}
+
+	UploadOptions struct {
+		Format    string `json:"format,omitempty"` // set for JSON imports, sniffed for uploads
+		Delimiter string `json:"delimiter"`
+		Sheet     string `json:"sheet,omitempty"`
+		Charset   string `json:"charset,omitempty"` // detected for each file if not set
+		Mode      string `json:"mode,omitempty"`
+		Policy    string `json:"policy,omitempty"`
+		DryRun    bool   `json:"dryRun"`
+		Force     bool   `json:"force"` // process files even if they were already processed
+		// MaxDeletePercent overrides the configured share of the employees a sync may delete.
+		MaxDeletePercent *float64 `json:"maxDeletePercent,omitempty"`
+	}
+
+	UploadFile struct {
+		Filename    string        `json:"filename"`
+		ContentHash string        `json:"contentHash"`
+		Archive     string        `json:"archive,omitempty"` // archive the file was expanded from
+		Status      string        `json:"status"`
+		UploadID    int64         `json:"uploadId,omitempty"`    // entry in the upload history
+		DuplicateOf int64         `json:"duplicateOf,omitempty"` // upload whose result was reused
+		Processed   bool          `json:"processed"`
+		Inserted    int           `json:"inserted"`
+		Updated     int           `json:"updated"`
+		Unchanged   int           `json:"unchanged"`
+		Skipped     int           `json:"skipped"`
+		Deleted     int           `json:"deleted"`
+		Comments    int           `json:"comments"`
+		Rejected    int           `json:"rejected,omitempty"` // rows left out in partial mode
+		Rejects     string        `json:"rejects,omitempty"`  // where to download the rejected rows
+		Diff        *EmployeeDiff `json:"diff,omitempty"`     // only kept for dry runs
+		Errors      []RowError    `json:"errors,omitempty"`
+		Error       string        `json:"error,omitempty"`
+	}
+
+	// UploadResult is the outcome of processing a single file.
+	UploadResult struct {
+		Diff     *EmployeeDiff
+		Comments int
+		Errors   []RowError // errors of the rejected rows in partial mode
+		Rejected int
+	}
+
+	AllUploadsResp struct {
+		Results []Upload `json:"results"`
+	}
+
+	// Upload is an entry in the upload history, recording a single processed file.
+	Upload struct {
+		ID          int64      `json:"id"`
+		JobID       string     `json:"jobId"`
+		Filename    string     `json:"filename"`
+		ContentHash string     `json:"contentHash"`
+		OptionsHash string     `json:"optionsHash"` // of the options that decide the result
+		Uploader    string     `json:"uploader"`
+		UploaderIP  string     `json:"uploaderIp,omitempty"`
+		DryRun      bool       `json:"dryRun"`
+		Outcome     string     `json:"outcome"`
+		DuplicateOf int64      `json:"duplicateOf,omitempty"`
+		Inserted    int        `json:"inserted"`
+		Updated     int        `json:"updated"`
+		Unchanged   int        `json:"unchanged"`
+		Skipped     int        `json:"skipped"`
+		Deleted     int        `json:"deleted"`
+		Failed      int        `json:"failed"`
+		Comments    int        `json:"comments"`
+		Error       string     `json:"error,omitempty"`
+		StartedAt   time.Time  `json:"startedAt"`
+		FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+		RevertedAt  *time.Time `json:"revertedAt,omitempty"`
+	}
+
+	// EmployeeSnapshot records an employee before and after an upload changed it. Before is nil
+	// if the upload inserted the employee, and After if it deleted the employee.
+	EmployeeSnapshot struct {
+		EmployeeID string
+		Before     *EmployeeReqResp
+		After      *EmployeeReqResp
+	}
+
+	UploadRevertResp struct {
+		Upload   Upload   `json:"upload"`
+		Restored []string `json:"restored"`
+		Deleted  []string `json:"deleted"`
+	}
+
+	// RevertConflict is an employee that changed after the upload being reverted. Actual is nil if
+	// the employee has since been deleted.
+	RevertConflict struct {
+		EmployeeID string           `json:"employeeId"`
+		Expected   *EmployeeReqResp `json:"expected"`
+		Actual     *EmployeeReqResp `json:"actual"`
+		Reason     string           `json:"reason"`
+	}
+)
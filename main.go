@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 )
 
 func main() {
@@ -18,8 +19,24 @@ func main() {
 	})
 
 	employeesDAO := daos.NewEmployeesDAO()
+	uploadJobsDAO := daos.NewUploadJobsDAO()
+	uploadsDAO := daos.NewUploadsDAO()
 
-	employees.NewHandler(employeesDAO).RouteGroup(r)
+	uploadConfig, err := employees.LoadUploadConfig()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid upload configuration")
+	}
+	// client addresses are only taken from the X-Forwarded-For header of the trusted proxies
+	r.TrustedProxies = uploadConfig.TrustedProxies
+
+	employeesHandler := employees.NewHandler(employeesDAO, uploadJobsDAO, uploadsDAO, uploadConfig)
+	if err := employeesHandler.StartUploadWorker(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to start the upload worker")
+	}
+	if err := employeesHandler.StartDropFolderWorker(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to start the drop folder worker")
+	}
+	employeesHandler.RouteGroup(r)
 
 	r.Run() // listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
 }
@@ -7,4 +7,84 @@ CREATE TABLE `employees` (
                              `salary` double NOT NULL,
                              PRIMARY KEY (`id`),
                              UNIQUE KEY `login` (`login`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+DROP TABLE IF EXISTS `upload_jobs`;
+
+CREATE TABLE `upload_jobs` (
+                               `id` varchar(36) NOT NULL,
+                               `state` varchar(16) NOT NULL,
+                               `uploader` varchar(128) NOT NULL,
+                               `uploader_ip` varchar(45) NOT NULL,
+                               `options` text NOT NULL,
+                               `files` mediumtext NOT NULL,
+                               `rows_processed` int NOT NULL DEFAULT 0,
+                               `rows_failed` int NOT NULL DEFAULT 0,
+                               `error` text,
+                               `created_at` datetime(6) NOT NULL,
+                               `started_at` datetime,
+                               `finished_at` datetime,
+                               PRIMARY KEY (`id`),
+                               KEY `state_created_at` (`state`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+DROP TABLE IF EXISTS `upload_job_details`;
+
+CREATE TABLE `upload_job_details` (
+                                      `job_id` varchar(36) NOT NULL,
+                                      `file_index` int NOT NULL,
+                                      `chunk` int NOT NULL,
+                                      `content` mediumtext NOT NULL,
+                                      PRIMARY KEY (`job_id`, `file_index`, `chunk`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+DROP TABLE IF EXISTS `uploads`;
+
+CREATE TABLE `uploads` (
+                           `id` bigint NOT NULL AUTO_INCREMENT,
+                           `job_id` varchar(36) NOT NULL,
+                           `filename` varchar(255) NOT NULL,
+                           `content_hash` char(64) NOT NULL,
+                           `options_hash` char(64) NOT NULL,
+                           `uploader` varchar(128) NOT NULL,
+                           `uploader_ip` varchar(45) NOT NULL,
+                           `dry_run` tinyint(1) NOT NULL,
+                           `outcome` varchar(16) NOT NULL,
+                           `duplicate_of` bigint,
+                           `inserted` int NOT NULL DEFAULT 0,
+                           `updated` int NOT NULL DEFAULT 0,
+                           `unchanged` int NOT NULL DEFAULT 0,
+                           `skipped` int NOT NULL DEFAULT 0,
+                           `deleted` int NOT NULL DEFAULT 0,
+                           `failed` int NOT NULL DEFAULT 0,
+                           `comments` int NOT NULL DEFAULT 0,
+                           `error` text,
+                           `started_at` datetime(6) NOT NULL,
+                           `finished_at` datetime(6),
+                           `reverted_at` datetime(6),
+                           PRIMARY KEY (`id`),
+                           KEY `job_id` (`job_id`),
+                           KEY `content_hash` (`content_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+DROP TABLE IF EXISTS `upload_snapshots`;
+
+CREATE TABLE `upload_snapshots` (
+                                    `upload_id` bigint NOT NULL,
+                                    `employee_id` varchar(16) NOT NULL,
+                                    `before_login` varchar(128),
+                                    `before_name` varchar(128),
+                                    `before_salary` double,
+                                    `after_login` varchar(128),
+                                    `after_name` varchar(128),
+                                    `after_salary` double,
+                                    PRIMARY KEY (`upload_id`, `employee_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+DROP TABLE IF EXISTS `upload_rejects`;
+
+CREATE TABLE `upload_rejects` (
+                                  `upload_id` bigint NOT NULL,
+                                  `content` longtext NOT NULL,
+                                  PRIMARY KEY (`upload_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
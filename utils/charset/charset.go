@@ -0,0 +1,90 @@
+package charset
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// Supported character encodings, by their canonical name.
+const (
+	UTF8        = "utf-8"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	Windows1252 = "windows-1252"
+)
+
+var aliases = map[string]string{
+	"utf-8":        UTF8,
+	"utf8":         UTF8,
+	"utf-16le":     UTF16LE,
+	"utf16le":      UTF16LE,
+	"utf-16be":     UTF16BE,
+	"utf16be":      UTF16BE,
+	"windows-1252": Windows1252,
+	"windows1252":  Windows1252,
+	"cp1252":       Windows1252,
+}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Lookup returns the canonical name of a supported encoding, accepting common aliases in any
+// case, e.g. "UTF8" or "cp1252".
+func Lookup(name string) (string, bool) {
+	charset, ok := aliases[strings.ToLower(strings.TrimSpace(name))]
+	return charset, ok
+}
+
+// Detect guesses the encoding of text from its beginning. A byte order mark decides it if there is
+// one. Otherwise text with a NUL byte in most odd or even positions is taken to be UTF-16, as ASCII
+// characters are in UTF-16, and anything else is UTF-8 if it is valid UTF-8, or Windows-1252.
+func Detect(sample []byte) string {
+	switch {
+	case bytes.HasPrefix(sample, bomUTF8):
+		return UTF8
+	case bytes.HasPrefix(sample, bomUTF16LE):
+		return UTF16LE
+	case bytes.HasPrefix(sample, bomUTF16BE):
+		return UTF16BE
+	}
+
+	var evenNULs, oddNULs int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenNULs++
+		} else {
+			oddNULs++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case pairs > 0 && oddNULs*2 > pairs:
+		return UTF16LE
+	case pairs > 0 && evenNULs*2 > pairs:
+		return UTF16BE
+	case utf8.Valid(trimPartialRune(sample)):
+		return UTF8
+	default:
+		return Windows1252
+	}
+}
+
+// trimPartialRune drops a UTF-8 sequence cut off at the end of a sample.
+func trimPartialRune(sample []byte) []byte {
+	for i := len(sample) - 1; i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(sample[i]) {
+			if !utf8.FullRune(sample[i:]) {
+				return sample[:i]
+			}
+			break
+		}
+	}
+	return sample
+}
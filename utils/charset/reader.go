@@ -0,0 +1,186 @@
+package charset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// sniffSize is how much of the text Detect is given when the encoding is not named.
+const sniffSize = 64 << 10
+
+// DecodeError is returned for bytes that are not valid in the encoding being read.
+type DecodeError struct {
+	Charset string
+	Offset  int64 // of the invalid bytes in the original text
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("invalid %v text at byte %v", e.Charset, e.Offset)
+}
+
+// undefined1252 marks the bytes that Windows-1252 leaves undefined.
+const undefined1252 = utf8.RuneError
+
+// windows1252 maps the bytes 0x80 to 0x9F, where Windows-1252 differs from ISO-8859-1.
+var windows1252 = [32]rune{
+	'€', undefined1252, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', undefined1252, 'Ž', undefined1252,
+	undefined1252, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', undefined1252, 'ž', 'Ÿ',
+}
+
+// decodeFunc decodes as much of in as it can, returning the UTF-8 text and the number of bytes
+// consumed. Bytes that may be the start of a character cut off at the end of in are left for the
+// next call, unless atEOF. invalid is the position of the first invalid byte, or -1.
+type decodeFunc func(in []byte, atEOF bool) (out []byte, consumed int, invalid int)
+
+// Reader transcodes text in one of the supported encodings to UTF-8, dropping a byte order mark.
+type Reader struct {
+	Charset string // the encoding being read, detected or as named
+
+	src    *bufio.Reader
+	decode decodeFunc
+	in     []byte // undecoded bytes
+	out    []byte // decoded bytes not yet read
+	offset int64  // of in[0] in the original text
+	buf    []byte
+	err    error
+}
+
+// NewReader returns a Reader for text in charset, or in the encoding guessed by Detect from the
+// beginning of the text if charset is empty.
+func NewReader(r io.Reader, charset string) (*Reader, error) {
+	src := bufio.NewReaderSize(r, sniffSize)
+	if charset == "" {
+		sample, err := src.Peek(sniffSize)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+		charset = Detect(sample)
+	}
+	reader := &Reader{Charset: charset, src: src, buf: make([]byte, 4096)}
+	var bom []byte
+	switch charset {
+	case UTF8:
+		reader.decode, bom = decodeUTF8, bomUTF8
+	case UTF16LE:
+		reader.decode, bom = utf16Decoder(binary.LittleEndian), bomUTF16LE
+	case UTF16BE:
+		reader.decode, bom = utf16Decoder(binary.BigEndian), bomUTF16BE
+	case Windows1252:
+		reader.decode = decodeWindows1252
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported charset %q", charset))
+	}
+	if bom != nil {
+		if prefix, _ := src.Peek(len(bom)); bytes.Equal(prefix, bom) {
+			src.Discard(len(bom))
+			reader.offset = int64(len(bom))
+		}
+	}
+	return reader, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 && r.err == nil {
+		r.fill()
+	}
+	if len(r.out) > 0 {
+		n := copy(p, r.out)
+		r.out = r.out[n:]
+		return n, nil
+	}
+	return 0, r.err
+}
+
+// fill decodes the next chunk of the original text.
+func (r *Reader) fill() {
+	n, err := r.src.Read(r.buf)
+	r.in = append(r.in, r.buf[:n]...)
+	atEOF := errors.Is(err, io.EOF)
+	if err != nil && !atEOF {
+		r.err = err
+		return
+	}
+
+	out, consumed, invalid := r.decode(r.in, atEOF)
+	r.out = out
+	if invalid >= 0 {
+		r.err = &DecodeError{Charset: r.Charset, Offset: r.offset + int64(invalid)}
+		return
+	}
+	r.offset += int64(consumed)
+	r.in = append(r.in[:0], r.in[consumed:]...)
+	if atEOF {
+		r.err = io.EOF
+	}
+}
+
+func decodeUTF8(in []byte, atEOF bool) ([]byte, int, int) {
+	i := 0
+	for i < len(in) {
+		if in[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		c, size := utf8.DecodeRune(in[i:])
+		if c == utf8.RuneError && size <= 1 {
+			if !atEOF && !utf8.FullRune(in[i:]) {
+				break
+			}
+			return append([]byte(nil), in[:i]...), i, i
+		}
+		i += size
+	}
+	return append([]byte(nil), in[:i]...), i, -1
+}
+
+func utf16Decoder(order binary.ByteOrder) decodeFunc {
+	return func(in []byte, atEOF bool) ([]byte, int, int) {
+		var out []byte
+		i := 0
+		for i+2 <= len(in) {
+			c := rune(order.Uint16(in[i:]))
+			if !utf16.IsSurrogate(c) {
+				out = utf8.AppendRune(out, c)
+				i += 2
+				continue
+			}
+			if i+4 > len(in) {
+				if atEOF {
+					return out, i, i
+				}
+				return out, i, -1
+			}
+			pair := utf16.DecodeRune(c, rune(order.Uint16(in[i+2:])))
+			if pair == utf8.RuneError {
+				return out, i, i
+			}
+			out = utf8.AppendRune(out, pair)
+			i += 4
+		}
+		if atEOF && i < len(in) {
+			return out, i, i
+		}
+		return out, i, -1
+	}
+}
+
+func decodeWindows1252(in []byte, atEOF bool) ([]byte, int, int) {
+	out := make([]byte, 0, len(in))
+	for i, b := range in {
+		c := rune(b)
+		if b >= 0x80 && b < 0xA0 {
+			c = windows1252[b-0x80]
+			if c == undefined1252 {
+				return out, i, i
+			}
+		}
+		out = utf8.AppendRune(out, c)
+	}
+	return out, len(in), -1
+}
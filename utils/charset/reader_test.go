@@ -0,0 +1,157 @@
+package charset
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample []byte
+		want   string
+	}{
+		{"empty", nil, UTF8},
+		{"ASCII", []byte("id,login,name,salary\n"), UTF8},
+		{"UTF-8", []byte("e0001,zoe,Zoë,1234.00\n"), UTF8},
+		{"UTF-8 byte order mark", []byte("\xEF\xBB\xBFid\n"), UTF8},
+		{"UTF-16LE byte order mark", []byte("\xFF\xFEi\x00d\x00"), UTF16LE},
+		{"UTF-16BE byte order mark", []byte("\xFE\xFF\x00i\x00d"), UTF16BE},
+		{"UTF-16LE without byte order mark", utf16LE("id,login\n"), UTF16LE},
+		{"UTF-16BE without byte order mark", utf16BE("id,login\n"), UTF16BE},
+		{"Windows-1252", []byte("e0001,zoe,Zo\xEB,1234.00\n"), Windows1252},
+		{"UTF-8 character cut off at the end of the sample", []byte("e0001,zoe,Zo\xC3"), UTF8},
+		{"invalid UTF-8 before the end of the sample", []byte("e0001,zoe,Zo\xC3,"), Windows1252},
+		{"few NUL bytes", []byte("e0001\x00,zoe,Zoe,1234.00\n"), UTF8},
+	}
+	for _, test := range tests {
+		if got := Detect(test.sample); got != test.want {
+			t.Errorf("Detect(%v) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"utf-8", UTF8, true},
+		{" UTF8 ", UTF8, true},
+		{"UTF-16LE", UTF16LE, true},
+		{"utf16be", UTF16BE, true},
+		{"CP1252", Windows1252, true},
+		{"latin1", "", false},
+	}
+	for _, test := range tests {
+		got, ok := Lookup(test.name)
+		if got != test.want || ok != test.ok {
+			t.Errorf("Lookup(%q) = %q, %v, want %q, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		charset string // detected if empty
+		want    string
+		// offset of the first invalid byte, or -1
+		invalid int64
+	}{
+		{name: "UTF-8", input: []byte("Zoë,😀\n"), want: "Zoë,😀\n", invalid: -1},
+		{name: "UTF-8 byte order mark is dropped", input: []byte("\xEF\xBB\xBFZoë"), want: "Zoë", invalid: -1},
+		{name: "invalid UTF-8", input: []byte("Zoë\xFF,Ron"), charset: UTF8, want: "Zoë", invalid: 4},
+		{name: "invalid UTF-8 after a byte order mark", input: []byte("\xEF\xBB\xBFZo\xFF"), charset: UTF8, want: "Zo", invalid: 5},
+		{name: "UTF-8 character cut off at the end", input: []byte("Zo\xC3"), charset: UTF8, want: "Zo", invalid: 2},
+		{name: "UTF-16LE", input: append([]byte("\xFF\xFE"), utf16LE("Zoë,😀\n")...), want: "Zoë,😀\n", invalid: -1},
+		{name: "UTF-16BE", input: append([]byte("\xFE\xFF"), utf16BE("Zoë,😀\n")...), want: "Zoë,😀\n", invalid: -1},
+		{name: "UTF-16LE without byte order mark", input: utf16LE("id,login\n"), want: "id,login\n", invalid: -1},
+		{name: "unpaired high surrogate", input: []byte("Z\x00\x3D\xD8o\x00"), charset: UTF16LE, want: "Z", invalid: 2},
+		{name: "unpaired low surrogate", input: []byte("Z\x00\x00\xDEo\x00"), charset: UTF16LE, want: "Z", invalid: 2},
+		{name: "high surrogate at the end", input: []byte("Z\x00\x3D\xD8"), charset: UTF16LE, want: "Z", invalid: 2},
+		{name: "odd byte at the end of UTF-16", input: []byte("\x00Z\x00"), charset: UTF16BE, want: "Z", invalid: 2},
+		{name: "Windows-1252", input: []byte("Zo\xEB \x80 \x92\x9F"), charset: Windows1252, want: "Zoë € ’Ÿ", invalid: -1},
+		{name: "undefined Windows-1252 byte", input: []byte("Zo\xEB \x81"), charset: Windows1252, want: "Zoë ", invalid: 4},
+		{name: "each undefined Windows-1252 byte", input: []byte("\x8D"), charset: Windows1252, invalid: 0},
+		{name: "Windows-1252 detected", input: []byte("Zo\xEB \x90"), want: "Zoë ", invalid: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// one byte at a time, splitting every character and surrogate pair across reads
+			reader, err := NewReader(iotest.OneByteReader(bytes.NewReader(test.input)), test.charset)
+			if err != nil {
+				t.Fatalf("NewReader() returned error %v", err)
+			}
+			got, err := io.ReadAll(reader)
+			if string(got) != test.want {
+				t.Errorf("read %q, want %q", got, test.want)
+			}
+
+			var decodeErr *DecodeError
+			switch {
+			case test.invalid < 0 && err != nil:
+				t.Errorf("read returned error %v", err)
+			case test.invalid >= 0 && !errors.As(err, &decodeErr):
+				t.Errorf("read returned error %v, want a *DecodeError", err)
+			case test.invalid >= 0 && (decodeErr.Offset != test.invalid || decodeErr.Charset != reader.Charset):
+				t.Errorf("read returned %v, want an invalid %v byte at %v", decodeErr, reader.Charset, test.invalid)
+			}
+		})
+	}
+}
+
+func TestReaderOffsetAfterSniffSize(t *testing.T) {
+	// an undefined byte in the second chunk of a large file
+	input := strings.Repeat("e0001,hpotter,Harry Potter,1234.00\n", sniffSize/16) + "\x81"
+	reader, err := NewReader(strings.NewReader(input), Windows1252)
+	if err != nil {
+		t.Fatalf("NewReader() returned error %v", err)
+	}
+	_, err = io.Copy(io.Discard, reader)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Offset != int64(len(input)-1) {
+		t.Errorf("read returned error %v, want an invalid byte at %v", err, len(input)-1)
+	}
+}
+
+func TestNewReaderUnsupported(t *testing.T) {
+	if _, err := NewReader(strings.NewReader("id"), "latin1"); err == nil {
+		t.Error("NewReader() returned no error for an unsupported charset")
+	}
+}
+
+func utf16LE(s string) []byte {
+	var b []byte
+	for _, c := range utf16Units(s) {
+		b = append(b, byte(c), byte(c>>8))
+	}
+	return b
+}
+
+func utf16BE(s string) []byte {
+	var b []byte
+	for _, c := range utf16Units(s) {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return b
+}
+
+func utf16Units(s string) []uint16 {
+	var units []uint16
+	for _, r := range s {
+		if r > 0xFFFF {
+			r -= 0x10000
+			units = append(units, uint16(0xD800+(r>>10)), uint16(0xDC00+(r&0x3FF)))
+			continue
+		}
+		units = append(units, uint16(r))
+	}
+	return units
+}
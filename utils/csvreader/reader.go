@@ -0,0 +1,193 @@
+package csvreader
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrQuote            = errors.New("extraneous or missing \" in quoted field")
+	ErrInvalidDelimiter = errors.New("invalid delimiter")
+)
+
+// Record is a single parsed CSV record.
+type Record struct {
+	Line   int // line the record starts on
+	Fields []string
+	Raw    string // original text of the record, without the trailing line break
+}
+
+type ParseError struct {
+	Line int
+	Raw  string // original text of the record, as far as it was read
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse error on line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Reader reads RFC 4180 records. Unlike encoding/csv it is lenient about bare quotes inside
+// unquoted fields, strips a leading UTF-8 BOM, and keeps the raw text of every record.
+type Reader struct {
+	Comma     rune // field delimiter, ',' by default
+	Comment   rune // lines starting with Comment are skipped, '#' by default
+	TrimSpace bool // trim whitespace surrounding fields, true by default
+
+	br       *bufio.Reader
+	line     int
+	comments int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		Comma:     ',',
+		Comment:   '#',
+		TrimSpace: true,
+		br:        bufio.NewReader(r),
+	}
+}
+
+// Read returns the next record, skipping blank and comment lines. It returns io.EOF once the
+// input is exhausted.
+func (r *Reader) Read() (*Record, error) {
+	if !validDelimiter(r.Comma) || r.Comma == r.Comment {
+		return nil, ErrInvalidDelimiter
+	}
+
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if r.Comment != 0 && strings.HasPrefix(line, string(r.Comment)) {
+			r.comments++
+			continue
+		}
+		return r.parseRecord(line)
+	}
+}
+
+// Comments returns the number of comment lines skipped so far.
+func (r *Reader) Comments() int {
+	return r.comments
+}
+
+func (r *Reader) readLine() (string, error) {
+	line, err := r.br.ReadString('\n')
+	if len(line) > 0 && errors.Is(err, io.EOF) {
+		// last line without a trailing line break
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	r.line++
+	if r.line == 1 {
+		line = strings.TrimPrefix(line, "\uFEFF")
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, nil
+}
+
+func (r *Reader) parseRecord(line string) (*Record, error) {
+	record := &Record{Line: r.line}
+	raw := line
+	pos := 0
+
+	for {
+		if r.TrimSpace {
+			pos = r.skipSpace(line, pos)
+		}
+
+		if pos < len(line) && line[pos] == '"' {
+			// quoted field, which may span several lines
+			pos++
+			var field strings.Builder
+			for {
+				i := strings.IndexByte(line[pos:], '"')
+				if i < 0 {
+					field.WriteString(line[pos:])
+					next, err := r.readLine()
+					if errors.Is(err, io.EOF) {
+						return nil, &ParseError{Line: record.Line, Raw: raw, Err: ErrQuote}
+					}
+					if err != nil {
+						return nil, err
+					}
+					field.WriteByte('\n')
+					raw += "\n" + next
+					line, pos = next, 0
+					continue
+				}
+
+				field.WriteString(line[pos : pos+i])
+				pos += i + 1
+				if pos < len(line) && line[pos] == '"' {
+					// escaped quote
+					field.WriteByte('"')
+					pos++
+					continue
+				}
+				break
+			}
+			record.Fields = append(record.Fields, field.String())
+
+			if r.TrimSpace {
+				pos = r.skipSpace(line, pos)
+			}
+			if pos == len(line) {
+				break
+			}
+			c, size := utf8.DecodeRuneInString(line[pos:])
+			if c != r.Comma {
+				return nil, &ParseError{Line: record.Line, Raw: raw, Err: ErrQuote}
+			}
+			pos += size
+			continue
+		}
+
+		i := strings.IndexRune(line[pos:], r.Comma)
+		var field string
+		if i < 0 {
+			field = line[pos:]
+		} else {
+			field = line[pos : pos+i]
+		}
+		if r.TrimSpace {
+			field = strings.TrimSpace(field)
+		}
+		record.Fields = append(record.Fields, field)
+		if i < 0 {
+			break
+		}
+		pos += i + utf8.RuneLen(r.Comma)
+	}
+
+	record.Raw = raw
+	return record, nil
+}
+
+func (r *Reader) skipSpace(line string, pos int) int {
+	for pos < len(line) && (line[pos] == ' ' || (line[pos] == '\t' && r.Comma != '\t')) {
+		pos++
+	}
+	return pos
+}
+
+func validDelimiter(c rune) bool {
+	return c != 0 && c != '"' && c != '\r' && c != '\n' && utf8.ValidRune(c) && c != utf8.RuneError
+}
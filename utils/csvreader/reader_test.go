@@ -0,0 +1,218 @@
+package csvreader
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readResult is a record or error returned by Read, compared by line, fields and raw text.
+type readResult struct {
+	line   int
+	fields []string
+	raw    string
+	err    error // wrapped by a *ParseError on line
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		comma    rune
+		want     []readResult
+		comments int
+	}{
+		{
+			name:  "plain fields",
+			input: "e0001,hpotter,Harry Potter,1234.00\ne0002,rwesley,Ron Weasley,19234.50\n",
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "hpotter", "Harry Potter", "1234.00"}, raw: "e0001,hpotter,Harry Potter,1234.00"},
+				{line: 2, fields: []string{"e0002", "rwesley", "Ron Weasley", "19234.50"}, raw: "e0002,rwesley,Ron Weasley,19234.50"},
+			},
+		},
+		{
+			name:  "quoted delimiter",
+			input: `e0001,hpotter,"Potter, Harry",1234.00`,
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "hpotter", "Potter, Harry", "1234.00"}, raw: `e0001,hpotter,"Potter, Harry",1234.00`},
+			},
+		},
+		{
+			name:  "escaped quotes",
+			input: `e0001,hpotter,"Harry ""The Boy"" Potter",""""`,
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "hpotter", `Harry "The Boy" Potter`, `"`}, raw: `e0001,hpotter,"Harry ""The Boy"" Potter",""""`},
+			},
+		},
+		{
+			name:  "empty fields",
+			input: `e0001,,"",`,
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "", "", ""}, raw: `e0001,,"",`},
+			},
+		},
+		{
+			name:  "CRLF line endings",
+			input: "e0001,hpotter,Harry Potter,1234.00\r\ne0002,rwesley,Ron Weasley,19234.50\r\n",
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "hpotter", "Harry Potter", "1234.00"}, raw: "e0001,hpotter,Harry Potter,1234.00"},
+				{line: 2, fields: []string{"e0002", "rwesley", "Ron Weasley", "19234.50"}, raw: "e0002,rwesley,Ron Weasley,19234.50"},
+			},
+		},
+		{
+			name:  "byte order mark",
+			input: "\uFEFFid,login,name,salary\n",
+			want: []readResult{
+				{line: 1, fields: []string{"id", "login", "name", "salary"}, raw: "id,login,name,salary"},
+			},
+		},
+		{
+			name:  "multi-line field",
+			input: "e0001,hpotter,\"Harry\r\nPotter\",1234.00\r\ne0002,rwesley,Ron Weasley,19234.50\n",
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "hpotter", "Harry\nPotter", "1234.00"}, raw: "e0001,hpotter,\"Harry\nPotter\",1234.00"},
+				{line: 3, fields: []string{"e0002", "rwesley", "Ron Weasley", "19234.50"}, raw: "e0002,rwesley,Ron Weasley,19234.50"},
+			},
+		},
+		{
+			name:  "comments and blank lines",
+			input: "# exported on Monday\n\ne0001,hpotter,Harry Potter,1234.00\n   \n#e0002,rwesley,Ron Weasley,19234.50\n",
+			want: []readResult{
+				{line: 3, fields: []string{"e0001", "hpotter", "Harry Potter", "1234.00"}, raw: "e0001,hpotter,Harry Potter,1234.00"},
+			},
+			comments: 2,
+		},
+		{
+			name:  "comment character inside a quoted field",
+			input: "e0001,hpotter,\"Harry\n# Potter\",1234.00\n",
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "hpotter", "Harry\n# Potter", "1234.00"}, raw: "e0001,hpotter,\"Harry\n# Potter\",1234.00"},
+			},
+		},
+		{
+			name:  "surrounding whitespace",
+			input: ` e0001 , hpotter ,  "Harry Potter"  , 1234.00 `,
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "hpotter", "Harry Potter", "1234.00"}, raw: ` e0001 , hpotter ,  "Harry Potter"  , 1234.00 `},
+			},
+		},
+		{
+			name:  "semicolon delimiter",
+			input: "e0001;hpotter;\"Potter; Harry\";1234,00\n",
+			comma: ';',
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "hpotter", "Potter; Harry", "1234,00"}, raw: "e0001;hpotter;\"Potter; Harry\";1234,00"},
+			},
+		},
+		{
+			name:  "tab delimiter",
+			input: "e0001\thpotter\tHarry Potter\t1234.00\n",
+			comma: '\t',
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "hpotter", "Harry Potter", "1234.00"}, raw: "e0001\thpotter\tHarry Potter\t1234.00"},
+			},
+		},
+		{
+			name:  "bare quote in an unquoted field",
+			input: `e0001,hpotter,Harry "HP" Potter,1234.00`,
+			want: []readResult{
+				{line: 1, fields: []string{"e0001", "hpotter", `Harry "HP" Potter`, "1234.00"}, raw: `e0001,hpotter,Harry "HP" Potter,1234.00`},
+			},
+		},
+		{
+			name:  "text after a closing quote",
+			input: "e0001,hpotter,\"Harry\" Potter,1234.00\ne0002,rwesley,Ron Weasley,19234.50\n",
+			want: []readResult{
+				{line: 1, raw: `e0001,hpotter,"Harry" Potter,1234.00`, err: ErrQuote},
+				{line: 2, fields: []string{"e0002", "rwesley", "Ron Weasley", "19234.50"}, raw: "e0002,rwesley,Ron Weasley,19234.50"},
+			},
+		},
+		{
+			name:  "text after a closing quote on a later line",
+			input: "e0001,hpotter,\"Harry\nPotter\" Jr,1234.00\n",
+			want: []readResult{
+				{line: 1, raw: "e0001,hpotter,\"Harry\nPotter\" Jr,1234.00", err: ErrQuote},
+			},
+		},
+		{
+			name:  "unterminated quote",
+			input: "e0001,hpotter,\"Harry Potter,1234.00\ne0002,rwesley,Ron Weasley,19234.50\n",
+			want: []readResult{
+				{line: 1, raw: "e0001,hpotter,\"Harry Potter,1234.00\ne0002,rwesley,Ron Weasley,19234.50", err: ErrQuote},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(test.input))
+			if test.comma != 0 {
+				reader.Comma = test.comma
+			}
+			var got []readResult
+			for {
+				record, err := reader.Read()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				var parseErr *ParseError
+				switch {
+				case errors.As(err, &parseErr):
+					got = append(got, readResult{line: parseErr.Line, raw: parseErr.Raw, err: parseErr.Err})
+				case err != nil:
+					t.Fatalf("Read() returned unexpected error %v", err)
+				default:
+					got = append(got, readResult{line: record.Line, fields: record.Fields, raw: record.Raw})
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Read() returned\n%#v\nwant\n%#v", got, test.want)
+			}
+			if reader.Comments() != test.comments {
+				t.Errorf("Comments() = %v, want %v", reader.Comments(), test.comments)
+			}
+		})
+	}
+}
+
+func TestReadInvalidDelimiter(t *testing.T) {
+	for _, comma := range []rune{0, '"', '\n', '#'} {
+		reader := NewReader(strings.NewReader("e0001,hpotter,Harry Potter,1234.00\n"))
+		reader.Comma = comma
+		if _, err := reader.Read(); !errors.Is(err, ErrInvalidDelimiter) {
+			t.Errorf("Read() with delimiter %q returned %v, want %v", comma, err, ErrInvalidDelimiter)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		fields []string
+		comma  rune
+		want   string
+	}{
+		{[]string{"e0001", "hpotter", "Harry Potter", "1234"}, ',', "e0001,hpotter,Harry Potter,1234"},
+		{[]string{"e0001", "Potter, Harry", `Harry "HP"`, ""}, ',', `e0001,"Potter, Harry","Harry ""HP""",`},
+		{[]string{"e0001", "Potter, Harry", "Potter; Harry"}, ';', `e0001;Potter, Harry;"Potter; Harry"`},
+		{[]string{"#e0001", " hpotter", "Harry\nPotter"}, ',', "\"#e0001\",\" hpotter\",\"Harry\nPotter\""},
+	}
+	for _, test := range tests {
+		got := Join(test.fields, test.comma)
+		if got != test.want {
+			t.Errorf("Join(%q) = %q, want %q", test.fields, got, test.want)
+		}
+
+		// every joined record reads back as the same fields
+		reader := NewReader(strings.NewReader(got))
+		reader.Comma = test.comma
+		reader.TrimSpace = false
+		record, err := reader.Read()
+		if err != nil {
+			t.Fatalf("Read(%q) returned error %v", got, err)
+		}
+		if !reflect.DeepEqual(record.Fields, test.fields) {
+			t.Errorf("Read(%q) = %q, want %q", got, record.Fields, test.fields)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package csvreader
+
+import (
+	"strings"
+)
+
+// Join formats fields as a single record, quoting the fields that need it.
+func Join(fields []string, comma rune) string {
+	var b strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteRune(comma)
+		}
+		b.WriteString(Quote(field, comma))
+	}
+	return b.String()
+}
+
+// Quote returns field as is unless it contains the delimiter, a quote, a line break or
+// surrounding whitespace, or starts with # like a comment, in which case it is quoted with any
+// quotes doubled.
+func Quote(field string, comma rune) string {
+	if field == "" || (!strings.ContainsAny(field, "\"\r\n"+string(comma)) && strings.TrimSpace(field) == field && !strings.HasPrefix(field, "#")) {
+		return field
+	}
+	return `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+}
@@ -29,3 +29,24 @@ func WithTxn(fn TxnFunc) (err error) {
 	err = fn(txn)
 	return err
 }
+
+// WithRollback runs fn in a transaction that is always rolled back, so fn can see the effect of
+// its writes without keeping them.
+func WithRollback(fn TxnFunc) (err error) {
+	txn, err := boil.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			txn.Rollback()
+			panic(p)
+		} else if rollbackErr := txn.Rollback(); err == nil {
+			err = rollbackErr
+		}
+	}()
+
+	err = fn(txn)
+	return err
+}
@@ -0,0 +1,369 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNotWorkbook   = errors.New("not an xlsx workbook")
+	ErrSheetNotFound = errors.New("sheet not found")
+	ErrPartTooLarge  = errors.New("workbook part too large")
+)
+
+// MaxMetadataSize is the most a relationships or workbook part may expand to. These parts list
+// the sheets of a workbook and are small, unlike the sheets and shared strings themselves.
+const MaxMetadataSize = 16 << 20
+
+// Guard wraps the decompressed content of a part of the workbook before it is decoded, e.g. to
+// limit how much the part may expand. compressed is the size of the part within the archive.
+type Guard func(part io.Reader, compressed int64) io.Reader
+
+// zipMagic is the signature every zip archive, and therefore every xlsx workbook, starts with.
+var zipMagic = []byte("PK\x03\x04")
+
+// IsZip reports whether header, the first bytes of a file, is the start of a zip archive.
+func IsZip(header []byte) bool {
+	return bytes.HasPrefix(header, zipMagic)
+}
+
+// IsWorkbook reports whether the zip archive contains an xlsx workbook.
+func IsWorkbook(r io.ReaderAt, size int64) bool {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return false
+	}
+	_, err = workbookPath(archive, nil)
+	return err == nil
+}
+
+// Row is a single non-empty row of a worksheet.
+type Row struct {
+	Number int // 1-based row number, as shown by spreadsheet applications
+	Cells  []string
+}
+
+// Reader streams the rows of a single worksheet. Cell values are returned as their text, with
+// numbers formatted the way they are stored in the file.
+type Reader struct {
+	rc            io.ReadCloser
+	decoder       *xml.Decoder
+	sharedStrings []string
+	rowNumber     int
+}
+
+// NewReader opens the named sheet of the workbook, or the first sheet when sheet is empty. Every
+// part read from the workbook is wrapped by guard, unless it is nil.
+func NewReader(r io.ReaderAt, size int64, sheet string, guard Guard) (*Reader, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrNotWorkbook
+	}
+
+	workbook, err := workbookPath(archive, guard)
+	if err != nil {
+		return nil, err
+	}
+	sheetPath, err := sheetPath(archive, workbook, sheet, guard)
+	if err != nil {
+		return nil, err
+	}
+
+	var sharedStrings []string
+	if f := findFile(archive, path.Join(path.Dir(workbook), "sharedStrings.xml")); f != nil {
+		if sharedStrings, err = readSharedStrings(f, guard); err != nil {
+			return nil, err
+		}
+	}
+
+	f := findFile(archive, sheetPath)
+	if f == nil {
+		return nil, ErrSheetNotFound
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		rc:            rc,
+		decoder:       xml.NewDecoder(guarded(rc, f, guard)),
+		sharedStrings: sharedStrings,
+	}, nil
+}
+
+// Read returns the next row of the sheet, skipping rows without any values. It returns io.EOF
+// once the sheet is exhausted.
+func (r *Reader) Read() (*Row, error) {
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row sheetRow
+		if err := r.decoder.DecodeElement(&row, &start); err != nil {
+			return nil, err
+		}
+		r.rowNumber++
+		if row.R != 0 {
+			r.rowNumber = row.R
+		}
+
+		cells, err := r.cells(row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", r.rowNumber, err)
+		}
+		if len(cells) > 0 {
+			return &Row{Number: r.rowNumber, Cells: cells}, nil
+		}
+	}
+}
+
+func (r *Reader) Close() error {
+	return r.rc.Close()
+}
+
+func (r *Reader) cells(row sheetRow) ([]string, error) {
+	var cells []string
+	next := 0
+	for _, c := range row.Cells {
+		// cells without a reference follow the previous cell, including empty ones
+		col := next
+		if c.R != "" {
+			var err error
+			if col, err = columnIndex(c.R); err != nil {
+				return nil, err
+			}
+		}
+		next = col + 1
+
+		var value string
+		switch c.T {
+		case "s":
+			i, err := strconv.Atoi(strings.TrimSpace(c.V))
+			if err != nil || i < 0 || i >= len(r.sharedStrings) {
+				return nil, fmt.Errorf("invalid shared string index %q", c.V)
+			}
+			value = r.sharedStrings[i]
+		case "inlineStr":
+			value = c.IS.text()
+		default:
+			value = c.V
+		}
+		if value == "" {
+			continue
+		}
+
+		for len(cells) < col {
+			cells = append(cells, "")
+		}
+		if col < len(cells) {
+			cells[col] = value
+		} else {
+			cells = append(cells, value)
+		}
+	}
+	return cells, nil
+}
+
+type sheetRow struct {
+	R     int         `xml:"r,attr"`
+	Cells []sheetCell `xml:"c"`
+}
+
+type sheetCell struct {
+	R  string     `xml:"r,attr"`
+	T  string     `xml:"t,attr"`
+	V  string     `xml:"v"`
+	IS stringItem `xml:"is"`
+}
+
+// stringItem is a shared or inline string, either plain or made of rich text runs.
+type stringItem struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s stringItem) text() string {
+	if len(s.Runs) == 0 {
+		return s.T
+	}
+	var b strings.Builder
+	b.WriteString(s.T)
+	for _, run := range s.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+// columnIndex converts the column letters of a cell reference such as "AB12" to a 0-based index.
+func columnIndex(ref string) (int, error) {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+	}
+	if i == 0 || col > 16384 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// guarded wraps the content of the part f in guard, if any.
+func guarded(rc io.Reader, f *zip.File, guard Guard) io.Reader {
+	if guard == nil {
+		return rc
+	}
+	return guard(rc, int64(f.CompressedSize64))
+}
+
+// metadataReader fails with ErrPartTooLarge once more than MaxMetadataSize bytes have been read.
+type metadataReader struct {
+	r    io.Reader
+	read int64
+}
+
+func (m *metadataReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.read += int64(n)
+	if m.read > MaxMetadataSize {
+		return n, ErrPartTooLarge
+	}
+	return n, err
+}
+
+// decodeMetadata decodes a relationships or workbook part into v.
+func decodeMetadata(f *zip.File, guard Guard, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(&metadataReader{r: guarded(rc, f, guard)}).Decode(v)
+}
+
+func readSharedStrings(f *zip.File, guard Guard) ([]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var sst struct {
+		Items []stringItem `xml:"si"`
+	}
+	if err := xml.NewDecoder(guarded(rc, f, guard)).Decode(&sst); err != nil {
+		return nil, err
+	}
+	strs := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		strs[i] = item.text()
+	}
+	return strs, nil
+}
+
+type relationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+func readRelationships(archive *zip.Reader, name string, guard Guard) (*relationships, error) {
+	f := findFile(archive, name)
+	if f == nil {
+		return nil, ErrNotWorkbook
+	}
+
+	var rels relationships
+	if err := decodeMetadata(f, guard, &rels); err != nil {
+		return nil, err
+	}
+	return &rels, nil
+}
+
+// workbookPath finds the workbook part through the package relationships.
+func workbookPath(archive *zip.Reader, guard Guard) (string, error) {
+	rels, err := readRelationships(archive, "_rels/.rels", guard)
+	if err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if strings.HasSuffix(rel.Type, "/officeDocument") {
+			target := strings.TrimPrefix(rel.Target, "/")
+			if findFile(archive, target) != nil {
+				return target, nil
+			}
+		}
+	}
+	return "", ErrNotWorkbook
+}
+
+// sheetPath resolves the part holding the named sheet, or the first sheet when name is empty.
+func sheetPath(archive *zip.Reader, workbook string, name string, guard Guard) (string, error) {
+	var wb struct {
+		Sheets []struct {
+			Name  string     `xml:"name,attr"`
+			Attrs []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeMetadata(findFile(archive, workbook), guard, &wb); err != nil {
+		return "", err
+	}
+
+	var relID string
+	for _, sheet := range wb.Sheets {
+		if name != "" && sheet.Name != name {
+			continue
+		}
+		for _, attr := range sheet.Attrs {
+			// r:id, whose namespace differs between transitional and strict workbooks
+			if attr.Name.Local == "id" && attr.Name.Space != "" {
+				relID = attr.Value
+			}
+		}
+		break
+	}
+	if relID == "" {
+		return "", ErrSheetNotFound
+	}
+
+	dir := path.Dir(workbook)
+	rels, err := readRelationships(archive, path.Join(dir, "_rels", path.Base(workbook)+".rels"), guard)
+	if err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != relID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join(dir, rel.Target), nil
+	}
+	return "", ErrSheetNotFound
+}
+
+func findFile(archive *zip.Reader, name string) *zip.File {
+	for _, f := range archive.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
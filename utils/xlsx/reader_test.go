@@ -0,0 +1,321 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testRootRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+	testWorkbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Notes" sheetId="1" r:id="rId1"/><sheet name="Salaries" sheetId="2" r:id="rId2"/></sheets></workbook>`
+
+	testWorkbookRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/></Relationships>`
+)
+
+// testParts returns the parts of a workbook with a Notes and a Salaries sheet, the latter given by
+// sheetData.
+func testParts(sheetData string) map[string]string {
+	return map[string]string{
+		"_rels/.rels":                testRootRels,
+		"xl/workbook.xml":            testWorkbook,
+		"xl/_rels/workbook.xml.rels": testWorkbookRels,
+		"xl/sharedStrings.xml":       `<sst><si><t>Harry Potter</t></si><si><r><t>Ron </t></r><r><t>Weasley</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml":   `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>notes</t></is></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml":   `<worksheet><sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+}
+
+func zipParts(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range parts {
+		f, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readRows(t *testing.T, workbook []byte, sheet string) ([]Row, error) {
+	t.Helper()
+	reader, err := NewReader(bytes.NewReader(workbook), int64(len(workbook)), sheet, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var rows []Row
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, *row)
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name      string
+		sheetData string
+		want      []Row
+		wantErr   bool
+	}{
+		{
+			name:      "shared, rich text, inline and number cells",
+			sheetData: `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>inline</t></is></c><c r="D1"><v>1234.5</v></c></row>`,
+			want:      []Row{{Number: 1, Cells: []string{"Harry Potter", "Ron Weasley", "inline", "1234.5"}}},
+		},
+		{
+			name:      "gaps between cells",
+			sheetData: `<row r="1"><c r="B1"><v>2</v></c><c r="D1"><v>4</v></c></row>`,
+			want:      []Row{{Number: 1, Cells: []string{"", "2", "", "4"}}},
+		},
+		{
+			name:      "cells without a reference",
+			sheetData: `<row r="1"><c r="B1"><v>2</v></c><c><v>3</v></c><c/><c><v>5</v></c></row>`,
+			want:      []Row{{Number: 1, Cells: []string{"", "2", "3", "", "5"}}},
+		},
+		{
+			name:      "empty rows are skipped",
+			sheetData: `<row r="1"><c r="A1"><v>1</v></c></row><row r="2"/><row r="3"><c r="A3" t="inlineStr"><is><t></t></is></c></row><row r="5"><c r="A5"><v>5</v></c></row>`,
+			want:      []Row{{Number: 1, Cells: []string{"1"}}, {Number: 5, Cells: []string{"5"}}},
+		},
+		{
+			name:      "rows without a number follow the previous row",
+			sheetData: `<row r="3"><c><v>3</v></c></row><row><c><v>4</v></c></row>`,
+			want:      []Row{{Number: 3, Cells: []string{"3"}}, {Number: 4, Cells: []string{"4"}}},
+		},
+		{
+			name:      "invalid shared string index",
+			sheetData: `<row r="1"><c r="A1" t="s"><v>2</v></c></row>`,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid cell reference",
+			sheetData: `<row r="1"><c r="11"><v>1</v></c></row>`,
+			wantErr:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := readRows(t, zipParts(t, testParts(test.sheetData)), "Salaries")
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Read() returned %v, want an error", rows)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() returned error %v", err)
+			}
+			if !reflect.DeepEqual(rows, test.want) {
+				t.Errorf("Read() returned %v, want %v", rows, test.want)
+			}
+		})
+	}
+}
+
+func TestNewReaderSheets(t *testing.T) {
+	workbook := zipParts(t, testParts(`<row r="1"><c r="A1"><v>1</v></c></row>`))
+	tests := []struct {
+		sheet string
+		want  []Row
+		err   error
+	}{
+		{sheet: "", want: []Row{{Number: 1, Cells: []string{"notes"}}}},
+		{sheet: "Notes", want: []Row{{Number: 1, Cells: []string{"notes"}}}},
+		{sheet: "Salaries", want: []Row{{Number: 1, Cells: []string{"1"}}}},
+		{sheet: "Missing", err: ErrSheetNotFound},
+	}
+	for _, test := range tests {
+		rows, err := readRows(t, workbook, test.sheet)
+		if !errors.Is(err, test.err) {
+			t.Errorf("NewReader(%q) returned error %v, want %v", test.sheet, err, test.err)
+		}
+		if !reflect.DeepEqual(rows, test.want) {
+			t.Errorf("NewReader(%q) read %v, want %v", test.sheet, rows, test.want)
+		}
+	}
+}
+
+func TestIsWorkbook(t *testing.T) {
+	workbook := zipParts(t, testParts(""))
+	if !IsZip(workbook) || !IsWorkbook(bytes.NewReader(workbook), int64(len(workbook))) {
+		t.Error("IsWorkbook() = false for a workbook")
+	}
+
+	archive := zipParts(t, map[string]string{"employees.csv": "e0001,hpotter,Harry Potter,1234.00\n"})
+	if !IsZip(archive) || IsWorkbook(bytes.NewReader(archive), int64(len(archive))) {
+		t.Error("IsWorkbook() = true for a zip archive of CSV files")
+	}
+
+	if IsZip([]byte("id,login,name,salary\n")) {
+		t.Error("IsZip() = true for a CSV file")
+	}
+}
+
+func TestNewReaderGuard(t *testing.T) {
+	parts := testParts(`<row r="1"><c r="A1"><v>1</v></c></row>`)
+	workbook := zipParts(t, parts)
+
+	var guarded int64
+	guard := func(part io.Reader, compressed int64) io.Reader {
+		return &countingReader{r: part, n: &guarded}
+	}
+	reader, err := NewReader(bytes.NewReader(workbook), int64(len(workbook)), "Salaries", guard)
+	if err != nil {
+		t.Fatalf("NewReader() returned error %v", err)
+	}
+	defer reader.Close()
+	for {
+		if _, err := reader.Read(); err != nil {
+			break
+		}
+	}
+
+	// every part but the unused first sheet is read through the guard
+	var want int64
+	for name, content := range parts {
+		if name != "xl/worksheets/sheet1.xml" {
+			want += int64(len(content))
+		}
+	}
+	if guarded != want {
+		t.Errorf("guard read %v bytes, want %v", guarded, want)
+	}
+
+	// a guard failing the sheet, the last part to be opened, fails reading its rows
+	errTooLarge := errors.New("too large")
+	opened := 0
+	failing := func(part io.Reader, compressed int64) io.Reader {
+		opened++
+		if opened == 5 {
+			return &errReader{errTooLarge}
+		}
+		return part
+	}
+	reader, err = NewReader(bytes.NewReader(workbook), int64(len(workbook)), "Salaries", failing)
+	if err != nil {
+		t.Fatalf("NewReader() returned error %v", err)
+	}
+	defer reader.Close()
+	if _, err := reader.Read(); !errors.Is(err, errTooLarge) {
+		t.Errorf("Read() through a failing guard returned %v, want %v", err, errTooLarge)
+	}
+}
+
+func TestNewReaderMetadataTooLarge(t *testing.T) {
+	parts := testParts("")
+	parts["xl/workbook.xml"] = strings.Replace(testWorkbook, "<sheets>", "<sheets>"+strings.Repeat(" ", MaxMetadataSize+1<<16), 1)
+	workbook := zipParts(t, parts)
+	if _, err := NewReader(bytes.NewReader(workbook), int64(len(workbook)), "", nil); !errors.Is(err, ErrPartTooLarge) {
+		t.Errorf("NewReader() returned error %v, want %v", err, ErrPartTooLarge)
+	}
+}
+
+// TestWriteRead writes a workbook and reads it back, as for an export uploaded again.
+func TestWriteRead(t *testing.T) {
+	rows := [][]interface{}{
+		{"id", "login", "name", "salary"},
+		{"e0001", "hpotter", "Harry Potter", 1234.0},
+		{"e0002", "rwesley", `Ron "Ronald" Weasley <&>`, 19234.5},
+		{"e0003", "ssnape", "  Severus\nSnape  ", 0.005},
+		{"e0004", "zoë", "Zoë", 4000},
+	}
+	want := []Row{
+		{Number: 1, Cells: []string{"id", "login", "name", "salary"}},
+		{Number: 2, Cells: []string{"e0001", "hpotter", "Harry Potter", "1234"}},
+		{Number: 3, Cells: []string{"e0002", "rwesley", `Ron "Ronald" Weasley <&>`, "19234.5"}},
+		{Number: 4, Cells: []string{"e0003", "ssnape", "  Severus\nSnape  ", "0.005"}},
+		{Number: 5, Cells: []string{"e0004", "zoë", "Zoë", "4000"}},
+	}
+
+	var buf bytes.Buffer
+	writer, err := NewWriter(&buf, `Employees & "Salaries"`)
+	if err != nil {
+		t.Fatalf("NewWriter() returned error %v", err)
+	}
+	for _, row := range rows {
+		if err := writer.Write(row...); err != nil {
+			t.Fatalf("Write() returned error %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() returned error %v", err)
+	}
+
+	got, err := readRows(t, buf.Bytes(), `Employees & "Salaries"`)
+	if err != nil {
+		t.Fatalf("Read() returned error %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() returned\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCellRef(t *testing.T) {
+	tests := []struct {
+		col  int
+		row  int
+		want string
+	}{
+		{0, 1, "A1"},
+		{25, 2, "Z2"},
+		{26, 3, "AA3"},
+		{701, 4, "ZZ4"},
+		{702, 5, "AAA5"},
+		{16383, 6, "XFD6"},
+	}
+	for _, test := range tests {
+		ref := cellRef(test.col, test.row)
+		if ref != test.want {
+			t.Errorf("cellRef(%v, %v) = %q, want %q", test.col, test.row, ref, test.want)
+		}
+		if col, err := columnIndex(ref); err != nil || col != test.col {
+			t.Errorf("columnIndex(%q) = %v, %v, want %v", ref, col, err, test.col)
+		}
+	}
+
+	for _, ref := range []string{"", "1", "a1", "XFE1"} {
+		if _, err := columnIndex(ref); err == nil {
+			t.Errorf("columnIndex(%q) returned no error", ref)
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}